@@ -11,12 +11,34 @@ func Migrate() {
 	err := DB.AutoMigrate(
 		&model.User{},
 		&model.Category{},
+		&model.CategoryTranslation{},
 		&model.Product{},
+		&model.ProductTranslation{},
+		&model.ProductDraft{},
+		&model.ProductRevision{},
+		&model.BundleComponent{},
+		&model.StockMovement{},
+		&model.Warehouse{},
+		&model.WarehouseStock{},
+		&model.StockSubscription{},
+		&model.GuestCart{},
 		&model.CartItem{},
+		&model.SavedItem{},
+		&model.CartReminder{},
+		&model.WishlistItem{},
+		&model.ExchangeRate{},
+		&model.Coupon{},
 		&model.Order{},
 		&model.OrderItem{},
+		&model.OrderItemAllocation{},
+		&model.DigitalDownload{},
 		&model.Comment{},
+		&model.CommentReport{},
+		&model.ProductQuestion{},
+		&model.ProductAnswer{},
+		&model.AnswerVote{},
 		&model.Banner{},
+		&model.ProductRelation{},
 	)
 
 	if err != nil {
@@ -0,0 +1,90 @@
+package boot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 通知內容，To 為空時代表通知管理員
+type Notification struct {
+	Type    string
+	To      string
+	Subject string
+	Message string
+	Data    map[string]any
+}
+
+type Notifier interface {
+	Send(ctx context.Context, notification Notification) error
+}
+
+var notifier Notifier = LogNotifier{}
+
+// 有設定 NOTIFY_WEBHOOK_URL 就用 webhook，否則只寫 log
+func ConnectNotifier() {
+	webhookURL := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if webhookURL == "" {
+		notifier = LogNotifier{}
+		log.Println("Notifier: log")
+		return
+	}
+
+	notifier = WebhookNotifier{URL: webhookURL}
+	log.Println("Notifier: webhook")
+}
+
+// 替換通知方式
+func SetNotifier(n Notifier) {
+	notifier = n
+}
+
+func Notify(ctx context.Context, notification Notification) error {
+	return notifier.Send(ctx, notification)
+}
+
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, notification Notification) error {
+	log.Printf("[通知] %v to=%q %v: %v\n", notification.Type, notification.To, notification.Subject, notification.Message)
+	return nil
+}
+
+// 把通知以 JSON POST 到指定網址
+type WebhookNotifier struct {
+	URL string
+}
+
+func (w WebhookNotifier) Send(ctx context.Context, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+
+	// 設定逾時
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded %v", res.Status)
+	}
+
+	return nil
+}
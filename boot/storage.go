@@ -57,6 +57,11 @@ func UploadFile(ctx context.Context, file *multipart.FileHeader) error {
 	return nil
 }
 
+// 讀取 bucket 內的檔案，用完需 Close
+func OpenFile(ctx context.Context, filename string) (*storage.Reader, error) {
+	return storageClient.Bucket(bucketName).Object(filename).NewReader(ctx)
+}
+
 func DeleteFile(ctx context.Context, filename string) error {
 	// 設定逾時
 	ctx, cancel := context.WithTimeout(ctx, time.Second*50)
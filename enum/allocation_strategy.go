@@ -0,0 +1,9 @@
+package enum
+
+type AllocationStrategy string
+
+const (
+	AllocationPriority AllocationStrategy = "priority" // 優先順序最高且能整單出貨的倉庫，不行再拆單
+	AllocationNearest  AllocationStrategy = "nearest"  // 距離最近且能整單出貨的倉庫，不行再拆單
+	AllocationSplit    AllocationStrategy = "split"    // 每個商品依優先順序從各倉庫扣
+)
@@ -0,0 +1,10 @@
+package enum
+
+type BannerLinkType string
+
+const (
+	BannerLinkNone     BannerLinkType = "none"
+	BannerLinkProduct  BannerLinkType = "product"
+	BannerLinkCategory BannerLinkType = "category"
+	BannerLinkURL      BannerLinkType = "url"
+)
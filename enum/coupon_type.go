@@ -0,0 +1,8 @@
+package enum
+
+type CouponType string
+
+const (
+	CouponTypePercent CouponType = "percent" // 百分比折扣
+	CouponTypeFixed   CouponType = "fixed"   // 固定金額折扣
+)
@@ -0,0 +1,14 @@
+package enum
+
+type StockMovementType string
+
+const (
+	StockMovementInitial       StockMovementType = "initial"
+	StockMovementAdminEdit     StockMovementType = "admin_edit"
+	StockMovementSale          StockMovementType = "sale"
+	StockMovementCancelRestock StockMovementType = "cancel_restock"
+	StockMovementReturn        StockMovementType = "return"
+	StockMovementAdjustment    StockMovementType = "adjustment"
+	StockMovementReconcile     StockMovementType = "reconcile"
+	StockMovementTransfer      StockMovementType = "transfer"
+)
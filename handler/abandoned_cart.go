@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type CartReminderStatsResponse struct {
+	Sent            int64
+	Recovered       int64
+	RecoveryRate    float64 // 0 ~ 1
+	RecoveredAmount float64 // 挽回訂單的基準幣總額
+}
+
+// 寄出提醒後多久內下單算挽回
+const cartRecoveryWindow = 7 * 24 * time.Hour
+
+// 購物車閒置多久算放棄，由 CART_ABANDON_AFTER 設定（預設 24h）
+func cartAbandonAfter() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("CART_ABANDON_AFTER"))
+	if err != nil || d <= 0 {
+		return 24 * time.Hour
+	}
+
+	return d
+}
+
+// 購物車閒置多久直接清除，由 CART_EXPIRE_AFTER 設定（預設 2160h）
+func cartExpireAfter() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("CART_EXPIRE_AFTER"))
+	if err != nil || d <= 0 {
+		return 90 * 24 * time.Hour
+	}
+
+	return d
+}
+
+// 提醒信裡回到購物車的連結，由 CART_REMINDER_URL 設定
+func cartReminderLink(reminderID uint) string {
+	base := os.Getenv("CART_REMINDER_URL")
+	if base == "" {
+		base = "/cart"
+	}
+
+	return fmt.Sprintf("%v?reminder=%v", base, reminderID)
+}
+
+// 找出閒置的會員購物車寄送提醒，同一次閒置只提醒一次
+func RemindAbandonedCarts() error {
+	now := time.Now()
+
+	type abandonedCart struct {
+		UserID       uint
+		LastActivity time.Time
+		ItemCount    uint
+	}
+	var carts []abandonedCart
+	err := boot.DB.Raw(`
+		SELECT carts.user_id, carts.last_activity, carts.item_count
+		FROM (
+			SELECT user_id, MAX(updated_at) AS last_activity, SUM(quantity) AS item_count
+			FROM cart_item
+			WHERE user_id IS NOT NULL
+			GROUP BY user_id
+		) carts
+		WHERE carts.last_activity < ? AND carts.last_activity >= ?
+		AND NOT EXISTS (
+			SELECT 1 FROM cart_reminder
+			WHERE cart_reminder.user_id = carts.user_id AND cart_reminder.sent_at >= carts.last_activity
+		)`,
+		now.Add(-cartAbandonAfter()), now.Add(-cartExpireAfter()),
+	).Scan(&carts).Error
+	if err != nil {
+		return err
+	}
+
+	for _, cart := range carts {
+		user := model.User{}
+		err := boot.DB.Select("id", "name", "email").First(&user, cart.UserID).Error
+		if err != nil {
+			log.Println("Find user failed:", err)
+			continue
+		}
+
+		// 先記錄再寄，避免重複提醒
+		reminder := model.CartReminder{
+			UserID:       user.ID,
+			LastActivity: cart.LastActivity,
+			ItemCount:    cart.ItemCount,
+			SentAt:       now,
+		}
+		err = boot.DB.Create(&reminder).Error
+		if err != nil {
+			log.Println("Create cart reminder failed:", err)
+			continue
+		}
+
+		link := cartReminderLink(reminder.ID)
+		err = boot.Notify(context.Background(), boot.Notification{
+			Type:    "abandoned_cart",
+			To:      user.Email,
+			Subject: "購物車還有商品",
+			Message: fmt.Sprintf("%v 您好，購物車裡還有 %v 件商品等著您：%v", user.Name, cart.ItemCount, link),
+			Data: map[string]any{
+				"ReminderID": reminder.ID,
+				"ItemCount":  cart.ItemCount,
+				"URL":        link,
+			},
+		})
+		if err != nil {
+			log.Println("Send abandoned cart notification failed:", err)
+		}
+	}
+
+	return nil
+}
+
+// 清除閒置太久的會員購物車和過期的訪客購物車
+func ExpireAbandonedCarts() error {
+	now := time.Now()
+
+	err := boot.DB.
+		Where("user_id IS NOT NULL").
+		Where("user_id IN (?)", boot.DB.Model(&model.CartItem{}).
+			Select("user_id").
+			Where("user_id IS NOT NULL").
+			Group("user_id").
+			Having("MAX(updated_at) < ?", now.Add(-cartExpireAfter()))).
+		Delete(&model.CartItem{}).Error
+	if err != nil {
+		return err
+	}
+
+	// 訪客 token 已過期，購物車也用不到了
+	return boot.DB.Where("created_at < ?", now.Add(-guestCartTTL())).Delete(&model.GuestCart{}).Error
+}
+
+// 下單後把期間內的提醒標記為挽回
+func markCartRecovered(tx *gorm.DB, userID uint, orderID uint) error {
+	now := time.Now()
+	return tx.Model(&model.CartReminder{}).
+		Where("user_id = ? AND recovered_at IS NULL AND sent_at >= ?", userID, now.Add(-cartRecoveryWindow)).
+		Updates(map[string]any{"recovered_at": now, "order_id": orderID}).Error
+}
+
+// 提醒寄送與挽回統計
+func GetCartReminderStats(ctx *gin.Context) {
+	res := CartReminderStatsResponse{}
+	err := boot.DB.Model(&model.CartReminder{}).Count(&res.Sent).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = boot.DB.Model(&model.CartReminder{}).Where("recovered_at IS NOT NULL").Count(&res.Recovered).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = boot.DB.Model(&model.Order{}).
+		Select("COALESCE(SUM(total_amount), 0)").
+		Where("id IN (?)", boot.DB.Model(&model.CartReminder{}).Select("order_id").Where("order_id IS NOT NULL")).
+		Scan(&res.RecoveredAmount).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if res.Sent > 0 {
+		res.RecoveryRate = math.Round(float64(res.Recovered)/float64(res.Sent)*10000) / 10000
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -11,19 +12,22 @@ import (
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"shop.go/boot"
+	"shop.go/enum"
 	"shop.go/model"
 	"shop.go/utils"
 )
 
 type SignupRequest struct {
-	Name     string `binding:"required"`
-	Email    string `binding:"required"`
-	Password string `binding:"required"`
+	Name      string `binding:"required"`
+	Email     string `binding:"required"`
+	Password  string `binding:"required"`
+	CartToken string // 訪客購物車，也可以用 X-Cart-Token header
 }
 
 type LoginRequest struct {
-	Email    string `binding:"required"`
-	Password string `binding:"required"`
+	Email     string `binding:"required"`
+	Password  string `binding:"required"`
+	CartToken string // 訪客購物車，也可以用 X-Cart-Token header
 }
 
 func Signup(role string) gin.HandlerFunc {
@@ -81,6 +85,11 @@ func Signup(role string) gin.HandlerFunc {
 			return
 		}
 
+		// 併入訪客購物車
+		if user.Role == string(enum.RoleUser) {
+			mergeGuestCartOnLogin(user.ID, cartTokenOf(ctx, req.CartToken))
+		}
+
 		ctx.JSON(http.StatusOK, user)
 	}
 }
@@ -123,6 +132,11 @@ func Login(userRoleList []string) gin.HandlerFunc {
 			return
 		}
 
+		// 併入訪客購物車
+		if user.Role == string(enum.RoleUser) {
+			mergeGuestCartOnLogin(user.ID, cartTokenOf(ctx, req.CartToken))
+		}
+
 		// 返回成功 Response
 		ctx.JSON(http.StatusOK, token)
 	}
@@ -140,7 +154,28 @@ func GetUser(ctx *gin.Context) {
 		Preload("CartItems", func(db *gorm.DB) *gorm.DB {
 			return db.Order("created_at ASC")
 		}).
-		Preload("CartItems.Product").First(&user, userID).Error
+		Preload("CartItems.Product").
+		Preload("SavedItems", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at DESC")
+		}).
+		Preload("SavedItems.Product").First(&user, userID).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 購物車重新計價並換算顯示幣別、語系
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	err = prepareCartItems(ctx, user.CartItems, rate)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = prepareSavedItems(ctx, user.SavedItems, rate)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -148,3 +183,32 @@ func GetUser(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, user)
 }
+
+// request 沒帶 cart token 時改用 header
+func cartTokenOf(ctx *gin.Context, token string) string {
+	if token != "" {
+		return token
+	}
+
+	return ctx.GetHeader("X-Cart-Token")
+}
+
+// 從 middleware.Auth 設定的 context 取出 user id
+func getUserID(ctx *gin.Context) (uint, error) {
+	userID, exists := ctx.Get("user_id")
+	if !exists {
+		return 0, errors.New("userID not exist")
+	}
+
+	id, err := strconv.ParseUint(userID.(string), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint(id), nil
+}
+
+// 從 middleware.Auth 設定的 context 判斷是否為管理員
+func isAdmin(ctx *gin.Context) bool {
+	return ctx.GetString("user_role") == string(enum.RoleAdmin)
+}
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddBannerRequest struct {
+	Title       string     `form:"Title" binding:"required"`
+	Description string     `form:"Description"`
+	IsActive    bool       `form:"IsActive"`
+	SortOrder   int        `form:"SortOrder"`
+	StartAt     *time.Time `form:"StartAt" time_format:"2006-01-02T15:04:05Z07:00"`
+	EndAt       *time.Time `form:"EndAt" time_format:"2006-01-02T15:04:05Z07:00"`
+	LinkType    string     `form:"LinkType" binding:"omitempty,oneof=none product category url"`
+	LinkTarget  string     `form:"LinkTarget"`
+}
+
+type ListBannersQuery struct {
+	PageQuery
+	Title string `form:"title"`
+}
+
+type ListBannersResponse struct {
+	List []model.Banner
+	PageInfo
+}
+
+// 後台依顯示順序排列
+var bannerPageOrder = pageOrder[model.Banner]{
+	Name: "banner_sort_order",
+	Keys: []pageKey[model.Banner]{
+		{Column: "banner.sort_order", Value: func(b model.Banner) any { return b.SortOrder }},
+		{Column: "banner.id", Value: func(b model.Banner) any { return b.ID }},
+	},
+}
+
+func AddBanner(ctx *gin.Context) {
+	req := AddBannerRequest{}
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	banner := model.Banner{}
+	err = applyBannerRequest(&banner, req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, err := ctx.FormFile("UploadedFile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 儲存檔案
+	ext := filepath.Ext(file.Filename)
+	file.Filename = uuid.New().String() + ext
+	log.Println(file.Filename)
+
+	err = boot.UploadFile(ctx, file)
+	if err != nil {
+		log.Println(err)
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// DB 存紀錄
+	banner.ImageURL = file.Filename
+	err = boot.DB.Create(&banner).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, banner)
+}
+
+func UpdateBanner(ctx *gin.Context) {
+	// 找橫幅
+	bannerId := ctx.Param("bannerId")
+	banner := model.Banner{}
+	err := boot.DB.First(&banner, bannerId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := AddBannerRequest{}
+	err = ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = applyBannerRequest(&banner, req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	boot.DB.Save(&banner)
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 加新圖片、刪舊圖片
+func UpdateBannerImage(ctx *gin.Context) {
+	// 找橫幅
+	bannerId := ctx.Param("bannerId")
+	banner := model.Banner{}
+	err := boot.DB.First(&banner, bannerId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	// Bucket 操作
+	file, err := ctx.FormFile("UploadedFile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ext := filepath.Ext(file.Filename)
+	file.Filename = uuid.New().String() + ext
+	log.Println(file.Filename)
+
+	err = boot.UploadFile(ctx, file)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = boot.DeleteFile(ctx, banner.ImageURL)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 存 DB
+	banner.ImageURL = file.Filename
+	boot.DB.Save(&banner)
+
+	ctx.JSON(http.StatusOK, "橫幅圖片更新成功")
+}
+
+func DeleteBanner(ctx *gin.Context) {
+	bannerId := ctx.Param("bannerId")
+	banner := model.Banner{}
+	err := boot.DB.First(&banner, bannerId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Unscoped().Delete(&banner).Error
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 圖片刪除失敗不影響結果
+	err = boot.DeleteFile(ctx, banner.ImageURL)
+	if err != nil {
+		log.Println(err)
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 管理員看全部橫幅
+func ListBanners(ctx *gin.Context) {
+	var query ListBannersQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 建立查詢
+	db := boot.DB.Model(&model.Banner{})
+
+	// 如果有搜尋標題，加入模糊搜尋
+	if query.Title != "" {
+		db = db.Where("title LIKE ?", "%"+query.Title+"%")
+	}
+
+	// 分頁查詢
+	banners, page, err := paginate(db, query.PageQuery, bannerPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListBannersResponse{
+		List:     banners,
+		PageInfo: page,
+	})
+}
+
+// 前台只顯示啟用中且在排程時間內的橫幅
+func ListActiveBanners(ctx *gin.Context) {
+	var banners []model.Banner
+	now := time.Now()
+
+	err := boot.DB.
+		Where("is_active = ?", true).
+		Where("start_at IS NULL OR start_at <= ?", now).
+		Where("end_at IS NULL OR end_at > ?", now).
+		Order("sort_order ASC, id ASC").
+		Find(&banners).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, banners)
+}
+
+// 驗證並套用橫幅欄位
+func applyBannerRequest(banner *model.Banner, req AddBannerRequest) error {
+	// 時間沒填視為不限制
+	if req.StartAt != nil && req.StartAt.IsZero() {
+		req.StartAt = nil
+	}
+	if req.EndAt != nil && req.EndAt.IsZero() {
+		req.EndAt = nil
+	}
+	if req.StartAt != nil && req.EndAt != nil && !req.EndAt.After(*req.StartAt) {
+		return errors.New("EndAt must be after StartAt")
+	}
+
+	// 檢查連結目標
+	linkType := enum.BannerLinkType(req.LinkType)
+	switch linkType {
+	case "", enum.BannerLinkNone:
+		linkType = enum.BannerLinkNone
+		req.LinkTarget = ""
+	case enum.BannerLinkProduct:
+		id, err := strconv.ParseUint(req.LinkTarget, 10, 64)
+		if err != nil || boot.DB.First(&model.Product{}, id).Error != nil {
+			return errors.New("linked product not found")
+		}
+	case enum.BannerLinkCategory:
+		id, err := strconv.ParseUint(req.LinkTarget, 10, 64)
+		if err != nil || boot.DB.First(&model.Category{}, id).Error != nil {
+			return errors.New("linked category not found")
+		}
+	case enum.BannerLinkURL:
+		u, err := url.ParseRequestURI(req.LinkTarget)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return errors.New("link url is not valid")
+		}
+	}
+
+	banner.Title = req.Title
+	banner.Description = req.Description
+	banner.IsActive = req.IsActive
+	banner.SortOrder = req.SortOrder
+	banner.StartAt = req.StartAt
+	banner.EndAt = req.EndAt
+	banner.LinkType = linkType
+	banner.LinkTarget = req.LinkTarget
+
+	return nil
+}
@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type BundleComponentRequest struct {
+	ProductID uint `binding:"required"`
+	Quantity  uint `binding:"required,min=1"`
+}
+
+type SetBundleComponentsRequest struct {
+	Components []BundleComponentRequest `binding:"required,min=1,dive"`
+}
+
+// 把商品設為組合商品並替換組成，售價沿用商品 Price
+func SetBundleComponents(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	bundle := model.Product{}
+	err := boot.DB.First(&bundle, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := SetBundleComponentsRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 組合商品本身不放庫存
+	if !bundle.IsBundle && bundle.StockQuantity > 0 {
+		ctx.JSON(http.StatusBadRequest, "請先把商品庫存調整為 0")
+		return
+	}
+
+	// 檢查組成商品
+	var componentIDs []uint
+	for _, c := range req.Components {
+		if c.ProductID == bundle.ID {
+			ctx.JSON(http.StatusBadRequest, "組合商品不能包含自己")
+			return
+		}
+		componentIDs = append(componentIDs, c.ProductID)
+	}
+
+	var count int64
+	err = boot.DB.Model(&model.Product{}).
+		Where("id IN ? AND is_bundle = ?", componentIDs, false).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count != int64(len(componentIDs)) {
+		ctx.JSON(http.StatusBadRequest, "組成商品不存在、重複或本身是組合商品")
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("bundle_id = ?", bundle.ID).Delete(&model.BundleComponent{}).Error
+		if err != nil {
+			return err
+		}
+
+		var components []model.BundleComponent
+		for _, c := range req.Components {
+			components = append(components, model.BundleComponent{
+				BundleID:    bundle.ID,
+				ComponentID: c.ProductID,
+				Quantity:    c.Quantity,
+			})
+		}
+		err = tx.Create(&components).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&bundle).Update("is_bundle", true).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 取消組合商品，變回一般商品
+func DeleteBundleComponents(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	bundle := model.Product{}
+	err := boot.DB.First(&bundle, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("bundle_id = ?", bundle.ID).Delete(&model.BundleComponent{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&bundle).Update("is_bundle", false).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 可以購買的商品，和 fillStockAvailability 算法相同：數位商品不看庫存，組合商品看組成商品
+var inStockSQL = `(product.is_digital OR (CASE WHEN product.is_bundle THEN COALESCE((
+	SELECT MIN(` + sellableStockOf("component") + ` / bundle_component.quantity) FROM bundle_component
+	JOIN product AS component ON component.id = bundle_component.component_id
+	WHERE bundle_component.bundle_id = product.id), 0) ELSE ` + sellableStockSQL + ` END) > 0)`
+
+// 把 StockQuantity 換成可售數量：停用倉庫的庫存不算
+// 組合商品的可售數量 = 各組成商品可售數量 / 每組數量 的最小值
+func fillStockAvailability(products []model.Product) error {
+	var productIDs, bundleIDs []uint
+	for _, p := range products {
+		if p.IsBundle {
+			bundleIDs = append(bundleIDs, p.ID)
+		} else if !p.IsDigital {
+			productIDs = append(productIDs, p.ID)
+		}
+	}
+
+	type row struct {
+		ID        uint
+		Available int64
+	}
+
+	available := map[uint]uint{}
+	if len(productIDs) > 0 {
+		var rows []row
+		err := boot.DB.Model(&model.Product{}).
+			Select("product.id, "+sellableStockSQL+" AS available").
+			Where("product.id IN ?", productIDs).
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			available[r.ID] = uint(max(r.Available, 0))
+		}
+	}
+
+	if len(bundleIDs) > 0 {
+		var rows []row
+		err := boot.DB.Model(&model.BundleComponent{}).
+			Select("bundle_component.bundle_id AS id, MIN("+sellableStockSQL+" / bundle_component.quantity) AS available").
+			Joins("JOIN product ON product.id = bundle_component.component_id").
+			Where("bundle_component.bundle_id IN ?", bundleIDs).
+			Group("bundle_component.bundle_id").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+		for _, r := range rows {
+			available[r.ID] = uint(max(r.Available, 0))
+		}
+	}
+
+	for i := range products {
+		if products[i].IsBundle || !products[i].IsDigital {
+			products[i].StockQuantity = available[products[i].ID]
+		}
+	}
+
+	return nil
+}
+
+// 加上組合商品的組成商品和組成商品所屬的組合商品 id，用於庫存通知
+// 組成商品補貨時，組合商品的可售數量也會跟著變
+func withBundleRelatedIDs(productIDs []uint) []uint {
+	var componentIDs []uint
+	err := boot.DB.Model(&model.BundleComponent{}).
+		Where("bundle_id IN ?", productIDs).
+		Pluck("component_id", &componentIDs).Error
+	if err != nil {
+		return productIDs
+	}
+
+	var bundleIDs []uint
+	err = boot.DB.Model(&model.BundleComponent{}).
+		Where("component_id IN ?", productIDs).
+		Pluck("bundle_id", &bundleIDs).Error
+	if err != nil {
+		return productIDs
+	}
+
+	ids := append(slices.Clone(productIDs), componentIDs...)
+	ids = append(ids, bundleIDs...)
+	slices.Sort(ids)
+
+	return slices.Compact(ids)
+}
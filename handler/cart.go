@@ -1,37 +1,192 @@
 package handler
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"shop.go/boot"
+	"shop.go/enum"
 	"shop.go/model"
+	"shop.go/utils"
 )
 
 type AddCartItemRequest struct {
-	ProductID uint
-	Quantity  uint
-	UnitPrice float64
+	ProductID uint `binding:"required"`
+	Quantity  uint `binding:"required,min=1"`
 }
 
 type UpdateCartItemRequest struct {
-	Quantity uint
+	Quantity *uint `binding:"required"` // 0 代表移除
 }
 
-func AddCartItem(ctx *gin.Context) {
-	// 找 user
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusBadRequest, "userID not exist")
+type CreateGuestCartResponse struct {
+	CartToken string // 之後用 X-Cart-Token header 帶上
+	ExpiresAt time.Time
+}
+
+// 購物車數量不符合庫存或購買上限
+type CartQuantityError struct {
+	Reason string
+}
+
+func (e *CartQuantityError) Error() string {
+	return e.Reason
+}
+
+// 購物車擁有者，會員或訪客擇一
+type cartOwner struct {
+	UserID      uint
+	GuestCartID string
+}
+
+var errCartOwnerRequired = errors.New("請登入或提供 cart token")
+
+// 只查這個擁有者的購物車項目
+func (o cartOwner) scope(db *gorm.DB) *gorm.DB {
+	if o.GuestCartID != "" {
+		return db.Where("guest_cart_id = ?", o.GuestCartID)
+	}
+
+	return db.Where("user_id = ?", o.UserID)
+}
+
+// 鎖定會員或訪客購物車，避免同時加入產生重複的項目
+func (o cartOwner) lock(tx *gorm.DB) error {
+	if o.GuestCartID != "" {
+		return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model.GuestCart{}, "id = ?", o.GuestCartID).Error
+	}
+
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model.User{}, o.UserID).Error
+}
+
+func (o cartOwner) newItem(productID uint, quantity uint, price float64) model.CartItem {
+	item := model.CartItem{
+		ProductID:  productID,
+		Quantity:   quantity,
+		UnitPrice:  price,
+		PriceAtAdd: price,
+	}
+	if o.GuestCartID != "" {
+		item.GuestCartID = &o.GuestCartID
+	} else {
+		item.UserID = &o.UserID
+	}
+
+	return item
+}
+
+// 單筆購物車項目的查詢範圍，管理員可以操作所有人的項目
+func cartItemScope(ctx *gin.Context) (func(db *gorm.DB) *gorm.DB, error) {
+	if isAdmin(ctx) {
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	owner, err := resolveCartOwner(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return owner.scope, nil
+}
+
+// 有登入用會員購物車，否則用 X-Cart-Token 的訪客購物車
+func resolveCartOwner(ctx *gin.Context) (cartOwner, error) {
+	if userID, err := getUserID(ctx); err == nil {
+		if ctx.GetString("user_role") != string(enum.RoleUser) {
+			return cartOwner{}, errCartOwnerRequired
+		}
+		return cartOwner{UserID: userID}, nil
+	}
+
+	cartID, err := utils.ValidateCartToken(ctx.GetHeader("X-Cart-Token"))
+	if err != nil {
+		return cartOwner{}, errCartOwnerRequired
+	}
+	err = boot.DB.First(&model.GuestCart{}, "id = ?", cartID).Error
+	if err != nil {
+		return cartOwner{}, errCartOwnerRequired
+	}
+
+	return cartOwner{GuestCartID: cartID}, nil
+}
+
+// 訪客購物車有效期限，由 GUEST_CART_TTL 設定（預設 720h）
+func guestCartTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("GUEST_CART_TTL"))
+	if err != nil || ttl <= 0 {
+		return 30 * 24 * time.Hour
+	}
+
+	return ttl
+}
+
+// 建立訪客購物車，回傳簽章過的 cart token
+func CreateGuestCart(ctx *gin.Context) {
+	cart := model.GuestCart{ID: uuid.New().String()}
+	err := boot.DB.Create(&cart).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
-	user := model.User{}
-	err := boot.DB.First(&user, userID).Error
+
+	ttl := guestCartTTL()
+	token, err := utils.GenerateCartToken(cart.ID, ttl)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	ctx.JSON(http.StatusOK, CreateGuestCartResponse{
+		CartToken: token,
+		ExpiresAt: cart.CreatedAt.Add(ttl),
+	})
+}
+
+// 會員或訪客的購物車
+func GetCart(ctx *gin.Context) {
+	owner, err := resolveCartOwner(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	items := []model.CartItem{}
+	err = owner.scope(boot.DB.Preload("Product")).Order("created_at ASC").Find(&items).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = prepareCartItems(ctx, items, rate)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, items)
+}
+
+func AddCartItem(ctx *gin.Context) {
+	owner, err := resolveCartOwner(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, err.Error())
+		return
+	}
+
 	// 從 body 拿資料
 	req := AddCartItemRequest{}
 	err = ctx.ShouldBindBodyWithJSON(&req)
@@ -40,48 +195,106 @@ func AddCartItem(ctx *gin.Context) {
 		return
 	}
 
-	// 存記錄到 CartItem table
-	cartItem := model.CartItem{
-		UserID:    user.ID,
-		ProductID: req.ProductID,
-		Quantity:  req.Quantity,
-		UnitPrice: req.UnitPrice,
+	// 只能加入已發佈的商品
+	product := model.Product{}
+	err = boot.DB.First(&product, req.ProductID).Error
+	if err != nil || product.Status != enum.ProductStatusPublished {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 同一商品合併成一筆
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		return addCartItem(tx, owner, product, req.Quantity)
+	})
+	var quantityErr *CartQuantityError
+	if errors.As(err, &quantityErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
 	}
-	err = boot.DB.Create(&cartItem).Error
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, "success")
 }
 
+// 數量為 0 時移除
 func UpdateCartItemQuantity(ctx *gin.Context) {
+	scope, err := cartItemScope(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, err.Error())
+		return
+	}
+
 	// Get Data
 	cartId := ctx.Param("cartItemId")
 	req := UpdateCartItemRequest{}
-	err := ctx.ShouldBindBodyWithJSON(&req)
+	err = ctx.ShouldBindBodyWithJSON(&req)
 	if err != nil {
 		ctx.String(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	// 更新
-	cart := model.CartItem{}
-	err = boot.DB.First(&cart, cartId).Error
+	// 鎖定項目後檢查並更新，避免同時更新超過上限
+	deleted := false
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		cart := model.CartItem{}
+		err := scope(tx.Clauses(clause.Locking{Strength: "UPDATE"})).First(&cart, cartId).Error
+		if err != nil {
+			return err
+		}
+
+		if *req.Quantity == 0 {
+			deleted = true
+			return tx.Delete(&cart).Error
+		}
+
+		product := model.Product{}
+		err = tx.First(&product, cart.ProductID).Error
+		if err != nil {
+			return err
+		}
+		err = checkCartQuantity(product, *req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&cart).Update("quantity", *req.Quantity).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	var quantityErr *CartQuantityError
+	if errors.As(err, &quantityErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
-	cart.Quantity = req.Quantity
-	boot.DB.Save(&cart)
+
+	if deleted {
+		ctx.JSON(http.StatusOK, "已刪除")
+		return
+	}
 
 	ctx.JSON(http.StatusOK, "success")
 }
 
 func DeleteCartItem(ctx *gin.Context) {
+	scope, err := cartItemScope(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, err.Error())
+		return
+	}
+
 	cartItemId := ctx.Param("cartItemId")
 
-	err := boot.DB.Unscoped().Delete(&model.CartItem{}, cartItemId).Error
+	err = scope(boot.DB.Unscoped()).Delete(&model.CartItem{}, cartItemId).Error
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
@@ -91,12 +304,13 @@ func DeleteCartItem(ctx *gin.Context) {
 }
 
 func DeleteAllCartItem(ctx *gin.Context) {
-	userID, exists := ctx.Get("user_id")
-	if !exists {
-		ctx.JSON(http.StatusBadRequest, "userID not exist")
+	owner, err := resolveCartOwner(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, err.Error())
 		return
 	}
-	err := boot.DB.Where("user_id = ?", userID).Delete(&model.CartItem{}).Error
+
+	err = owner.scope(boot.DB).Delete(&model.CartItem{}).Error
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
@@ -104,3 +318,249 @@ func DeleteAllCartItem(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, "已刪除")
 }
+
+// 重新計價、標記無法購買的項目，並換算幣別與語系，需先 Preload Product
+func prepareCartItems(ctx *gin.Context, items []model.CartItem, rate currencyRate) error {
+	err := repriceCartItems(boot.DB, items)
+	if err != nil {
+		return err
+	}
+
+	err = markUnavailableCartItems(items)
+	if err != nil {
+		return err
+	}
+
+	fillCartItemPrices(items, rate)
+
+	products := make([]model.Product, len(items))
+	for i := range items {
+		products[i] = items[i].Product
+	}
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].Product = products[i]
+	}
+
+	return nil
+}
+
+// 檢查商品是否可以買這個數量
+func checkCartQuantity(product model.Product, quantity uint) error {
+	products := []model.Product{product}
+	err := fillStockAvailability(products)
+	if err != nil {
+		return err
+	}
+
+	reason := cartItemProblem(products[0], quantity)
+	if reason != "" {
+		return &CartQuantityError{Reason: reason}
+	}
+
+	return nil
+}
+
+// 可以放進購物車的最大數量，無法購買時為 0
+func maxCartQuantity(product model.Product) (uint, error) {
+	products := []model.Product{product}
+	err := fillStockAvailability(products)
+	if err != nil {
+		return 0, err
+	}
+	product = products[0]
+
+	if product.Status != enum.ProductStatusPublished {
+		return 0, nil
+	}
+
+	limit := ^uint(0)
+	if product.MaxPerOrder != nil {
+		limit = *product.MaxPerOrder
+	}
+	if !product.IsDigital {
+		limit = min(limit, product.StockQuantity)
+	}
+
+	return limit, nil
+}
+
+// 標記無法購買的購物車項目，需先 Preload Product
+func markUnavailableCartItems(items []model.CartItem) error {
+	products := make([]model.Product, len(items))
+	for i := range items {
+		products[i] = items[i].Product
+	}
+	err := fillStockAvailability(products)
+	if err != nil {
+		return err
+	}
+
+	for i := range items {
+		items[i].Unavailable = cartItemProblem(products[i], items[i].Quantity)
+	}
+
+	return nil
+}
+
+// 無法購買的原因，空字串代表可以購買；需先計算可售數量
+func cartItemProblem(product model.Product, quantity uint) string {
+	if product.Status != enum.ProductStatusPublished {
+		return "商品已下架"
+	}
+	if product.MaxPerOrder != nil && quantity > *product.MaxPerOrder {
+		return fmt.Sprintf("每筆訂單最多購買 %v 件", *product.MaxPerOrder)
+	}
+	if !product.IsDigital && quantity > product.StockQuantity {
+		return "庫存不足"
+	}
+
+	return ""
+}
+
+// 加入購物車，同一商品合併成一筆，售價以伺服器為準
+func addCartItem(tx *gorm.DB, owner cartOwner, product model.Product, quantity uint) error {
+	err := owner.lock(tx)
+	if err != nil {
+		return err
+	}
+
+	var lines []model.CartItem
+	err = owner.scope(tx.Clauses(clause.Locking{Strength: "UPDATE"})).Where("product_id = ?", product.ID).Order("id ASC").Find(&lines).Error
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		quantity += line.Quantity
+	}
+	err = checkCartQuantity(product, quantity)
+	if err != nil {
+		return err
+	}
+
+	return setCartLine(tx, owner, product, lines, quantity)
+}
+
+// 把同一商品的項目設成指定數量，舊資料的重複項目一併合併
+func setCartLine(tx *gorm.DB, owner cartOwner, product model.Product, lines []model.CartItem, quantity uint) error {
+	price := effectivePrice(product)
+	if len(lines) == 0 {
+		item := owner.newItem(product.ID, quantity, price)
+		return tx.Create(&item).Error
+	}
+
+	if len(lines) > 1 {
+		var duplicateIDs []uint
+		for _, line := range lines[1:] {
+			duplicateIDs = append(duplicateIDs, line.ID)
+		}
+		err := tx.Delete(&model.CartItem{}, duplicateIDs).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Model(&lines[0]).Updates(map[string]any{
+		"quantity":   quantity,
+		"unit_price": price,
+	}).Error
+}
+
+// 訪客購物車併入會員購物車，同一商品的數量依 CART_MERGE_STRATEGY 決定
+//   - sum（預設）：兩邊相加
+//   - max：取較大的
+//   - guest：以訪客購物車為準
+//   - user：會員購物車已有的商品保留原數量
+//
+// 合併後超過庫存或購買上限的調整成可購買的最大數量，已下架的商品略過
+func mergeGuestCart(userID uint, token string) error {
+	cartID, err := utils.ValidateCartToken(token)
+	if err != nil {
+		return err
+	}
+
+	return boot.DB.Transaction(func(tx *gorm.DB) error {
+		cart := model.GuestCart{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cart, "id = ?", cartID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var guestItems []model.CartItem
+		err = tx.Preload("Product").Where("guest_cart_id = ?", cart.ID).Order("id ASC").Find(&guestItems).Error
+		if err != nil {
+			return err
+		}
+
+		owner := cartOwner{UserID: userID}
+		err = owner.lock(tx)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range guestItems {
+			var lines []model.CartItem
+			err := owner.scope(tx).Where("product_id = ?", item.ProductID).Order("id ASC").Find(&lines).Error
+			if err != nil {
+				return err
+			}
+
+			var existing uint
+			for _, line := range lines {
+				existing += line.Quantity
+			}
+
+			quantity := existing + item.Quantity
+			switch os.Getenv("CART_MERGE_STRATEGY") {
+			case "max":
+				quantity = max(existing, item.Quantity)
+			case "guest":
+				quantity = item.Quantity
+			case "user":
+				if existing > 0 {
+					quantity = existing
+				}
+			}
+
+			limit, err := maxCartQuantity(item.Product)
+			if err != nil {
+				return err
+			}
+			quantity = min(quantity, limit)
+			if quantity == 0 || (quantity == existing && len(lines) <= 1) {
+				continue
+			}
+
+			err = setCartLine(tx, owner, item.Product, lines, quantity)
+			if err != nil {
+				return err
+			}
+		}
+
+		err = tx.Where("guest_cart_id = ?", cart.ID).Delete(&model.CartItem{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&cart).Error
+	})
+}
+
+// 登入或註冊時帶了 cart token 就合併，失敗只記錄不影響登入
+func mergeGuestCartOnLogin(userID uint, token string) {
+	if token == "" {
+		return
+	}
+
+	err := mergeGuestCart(userID, token)
+	if err != nil {
+		log.Println("Merge guest cart failed:", err)
+	}
+}
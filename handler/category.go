@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,13 +10,14 @@ import (
 )
 
 type AddCategoryRequest struct {
-	Name        string `binding:"required"`
-	Description string `binding:"required"`
+	Name              string `binding:"required"`
+	Description       string `binding:"required"`
+	LowStockThreshold *uint  // 沒填使用預設值
 }
 
 type ListCategoryResponse struct {
-	List  []model.Category
-	Total int64
+	List []model.Category
+	PageInfo
 }
 
 type DeleteCategoryRequest struct {
@@ -23,9 +25,15 @@ type DeleteCategoryRequest struct {
 }
 
 type ListCategoryQuery struct {
-	CurrentPage int    `form:"currentPage" binding:"required"`
-	PerPage     int    `form:"perPage" binding:"required"`
-	Name        string `form:"name"`
+	PageQuery
+	Name string `form:"name"`
+}
+
+var categoryPageOrder = pageOrder[model.Category]{
+	Name: "category_id",
+	Keys: []pageKey[model.Category]{
+		{Column: "category.id", Value: func(c model.Category) any { return c.ID }},
+	},
 }
 
 func AddCategory(ctx *gin.Context) {
@@ -37,8 +45,9 @@ func AddCategory(ctx *gin.Context) {
 	}
 
 	category := model.Category{
-		Name:        req.Name,
-		Description: req.Description,
+		Name:              req.Name,
+		Description:       req.Description,
+		LowStockThreshold: req.LowStockThreshold,
 	}
 	err = boot.DB.Create(&category).Error
 	if err != nil {
@@ -50,8 +59,6 @@ func AddCategory(ctx *gin.Context) {
 }
 
 func ListCategories(ctx *gin.Context) {
-	var categories []model.Category
-	var total int64
 	var query ListCategoryQuery
 
 	// 自動綁定和驗證
@@ -68,22 +75,27 @@ func ListCategories(ctx *gin.Context) {
 		db = db.Where("name LIKE ?", "%"+query.Name+"%")
 	}
 
-	// 計算總數
-	db.Count(&total)
-
-	// 只有當 CurrentPage 和 PerPage 都是 -1 時才返回全部，否則必須分頁
-	if query.CurrentPage == -1 && query.PerPage == -1 {
-		// 返回全部資料
-		db.Find(&categories)
-	} else {
-		// 分頁查詢
-		offset := (query.CurrentPage - 1) * query.PerPage
-		db.Offset(offset).Limit(query.PerPage).Find(&categories)
+	// 分頁查詢
+	categories, page, err := paginate(db, query.PageQuery, categoryPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 語系
+	err = localizeCategories(categories, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, ListCategoryResponse{
-		List:  categories,
-		Total: total,
+		List:     categories,
+		PageInfo: page,
 	})
 }
 
@@ -106,6 +118,9 @@ func UpdateCategory(ctx *gin.Context) {
 	}
 	category.Name = req.Name
 	category.Description = req.Description
+	if req.LowStockThreshold != nil {
+		category.LowStockThreshold = req.LowStockThreshold
+	}
 	boot.DB.Save(&category)
 
 	ctx.JSON(http.StatusOK, "更新成功")
@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type CheckoutPreviewRequest struct {
+	RecipientAddress string
+	CouponCode       string
+	Currency         string // 付款幣別，沒填用 query currency 或 X-Currency header
+}
+
+type CheckoutLine struct {
+	ProductID uint
+	Name      string
+	Quantity  uint
+	UnitPrice float64
+	Amount    float64
+}
+
+// 結帳金額明細，金額皆為基準幣，ChargedAmount 為付款幣別
+type CheckoutBreakdown struct {
+	Items         []CheckoutLine
+	Subtotal      float64
+	CouponCode    string `json:",omitempty"`
+	Discount      float64
+	Shipping      float64
+	Tax           float64
+	GrandTotal    float64
+	Currency      string
+	ExchangeRate  float64
+	ChargedAmount float64
+
+	coupon *model.Coupon
+}
+
+// 結帳預覽，下單時用同樣的方式重新計算並核對
+func PreviewCheckout(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := CheckoutPreviewRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	rate, err := lookupCurrency(checkoutCurrency(ctx, req.Currency))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	breakdown, _, err := calculateCheckout(boot.DB, userID, req.RecipientAddress, req.CouponCode, rate)
+	if err != nil {
+		ctx.JSON(checkoutErrorStatus(err), err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, breakdown)
+}
+
+// 付款幣別，沒填用 query currency 或 X-Currency header
+func checkoutCurrency(ctx *gin.Context, currency string) string {
+	if currency == "" {
+		currency = ctx.Query("currency")
+	}
+	if currency == "" {
+		currency = ctx.GetHeader("X-Currency")
+	}
+
+	return currency
+}
+
+// 計算購物車結帳金額：小計 - 折扣 + 運費 + 稅
+func calculateCheckout(db *gorm.DB, userID uint, address string, couponCode string, rate currencyRate) (CheckoutBreakdown, []model.CartItem, error) {
+	breakdown := CheckoutBreakdown{}
+
+	var cartItems []model.CartItem
+	err := db.Preload("Product").Where("user_id = ?", userID).Order("id ASC").Find(&cartItems).Error
+	if err != nil {
+		return breakdown, nil, err
+	}
+	if len(cartItems) == 0 {
+		return breakdown, nil, errEmptyCart
+	}
+
+	quantities := map[uint]uint{}
+	hasPhysical := false
+	for _, cartItem := range cartItems {
+		if cartItem.Product.Status != enum.ProductStatusPublished {
+			return breakdown, nil, errProductUnavailable
+		}
+		quantities[cartItem.ProductID] += cartItem.Quantity
+		if !cartItem.Product.IsDigital {
+			hasPhysical = true
+		}
+	}
+
+	// 購買上限，庫存由 reserveStock 檢查
+	for _, cartItem := range cartItems {
+		limit := cartItem.Product.MaxPerOrder
+		if limit != nil && quantities[cartItem.ProductID] > *limit {
+			return breakdown, nil, &CartQuantityError{Reason: fmt.Sprintf("%v 每筆訂單最多購買 %v 件", cartItem.Product.Name, *limit)}
+		}
+	}
+
+	// 有實體商品才需要收件地址
+	if hasPhysical && address == "" {
+		return breakdown, nil, errAddressRequired
+	}
+
+	// 以伺服器計算的售價為準
+	err = repriceCartItems(db, cartItems)
+	if err != nil {
+		return breakdown, nil, err
+	}
+
+	// 優惠券
+	var coupon *model.Coupon
+	if code := normalizeCouponCode(couponCode); code != "" {
+		coupon = &model.Coupon{}
+		err = db.Where("code = ?", code).First(coupon).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return breakdown, nil, &CouponError{Reason: "優惠碼無效"}
+		}
+		if err != nil {
+			return breakdown, nil, err
+		}
+	}
+
+	breakdown, err = checkoutTotals(cartItems, coupon, rate)
+	if err != nil {
+		return breakdown, nil, err
+	}
+
+	return breakdown, cartItems, nil
+}
+
+// 用已計價的購物車與優惠券算出金額明細
+func checkoutTotals(cartItems []model.CartItem, coupon *model.Coupon, rate currencyRate) (CheckoutBreakdown, error) {
+	breakdown := CheckoutBreakdown{}
+
+	hasPhysical := false
+	for _, cartItem := range cartItems {
+		amount := roundAmount(cartItem.UnitPrice * float64(cartItem.Quantity))
+		breakdown.Items = append(breakdown.Items, CheckoutLine{
+			ProductID: cartItem.ProductID,
+			Name:      cartItem.Product.Name,
+			Quantity:  cartItem.Quantity,
+			UnitPrice: cartItem.UnitPrice,
+			Amount:    amount,
+		})
+		breakdown.Subtotal += amount
+		if !cartItem.Product.IsDigital {
+			hasPhysical = true
+		}
+	}
+	breakdown.Subtotal = roundAmount(breakdown.Subtotal)
+
+	if coupon != nil {
+		discount, err := couponDiscount(*coupon, breakdown.Subtotal)
+		if err != nil {
+			return breakdown, err
+		}
+		breakdown.Discount = discount
+		breakdown.CouponCode = coupon.Code
+		breakdown.coupon = coupon
+	}
+	discounted := breakdown.Subtotal - breakdown.Discount
+
+	// 只有實體商品要運費，達門檻免運
+	if hasPhysical {
+		breakdown.Shipping = checkoutAmountEnv("SHIPPING_FEE")
+		threshold := checkoutAmountEnv("SHIPPING_FREE_THRESHOLD")
+		if threshold > 0 && discounted >= threshold {
+			breakdown.Shipping = 0
+		}
+	}
+
+	breakdown.Tax = roundAmount(discounted * checkoutAmountEnv("TAX_RATE"))
+	breakdown.GrandTotal = roundAmount(discounted + breakdown.Shipping + breakdown.Tax)
+	breakdown.Currency = rate.Currency
+	breakdown.ExchangeRate = rate.Rate
+	breakdown.ChargedAmount = rate.convert(breakdown.GrandTotal)
+
+	return breakdown, nil
+}
+
+// 讀取金額設定，沒設定或格式錯誤為 0
+func checkoutAmountEnv(key string) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+
+	return value
+}
+
+// 四捨五入到小數第二位
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+func checkoutErrorStatus(err error) int {
+	var quantityErr *CartQuantityError
+	var couponErr *CouponError
+	switch {
+	case errors.As(err, &quantityErr), errors.As(err, &couponErr):
+		return http.StatusBadRequest
+	case errors.Is(err, errEmptyCart), errors.Is(err, errAddressRequired), errors.Is(err, errProductUnavailable):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+func setCheckoutEnv(t *testing.T) {
+	t.Setenv("SHIPPING_FEE", "60")
+	t.Setenv("SHIPPING_FREE_THRESHOLD", "1000")
+	t.Setenv("TAX_RATE", "0.05")
+}
+
+func physicalCartItem(productID uint, unitPrice float64, quantity uint) model.CartItem {
+	return model.CartItem{
+		ProductID: productID,
+		Quantity:  quantity,
+		UnitPrice: unitPrice,
+		Product:   model.Product{ID: productID, Name: "實體商品"},
+	}
+}
+
+func digitalCartItem(productID uint, unitPrice float64, quantity uint) model.CartItem {
+	return model.CartItem{
+		ProductID: productID,
+		Quantity:  quantity,
+		UnitPrice: unitPrice,
+		Product:   model.Product{ID: productID, Name: "數位商品", IsDigital: true},
+	}
+}
+
+func TestCheckoutTotals(t *testing.T) {
+	setCheckoutEnv(t)
+	twd := currencyRate{Currency: "TWD", Rate: 1}
+
+	tests := []struct {
+		name      string
+		items     []model.CartItem
+		coupon    *model.Coupon
+		rate      currencyRate
+		subtotal  float64
+		discount  float64
+		shipping  float64
+		tax       float64
+		total     float64
+		charged   float64
+		couponTag string
+	}{
+		{
+			name:     "未達免運門檻收運費",
+			items:    []model.CartItem{physicalCartItem(1, 100, 2), digitalCartItem(2, 50, 1)},
+			rate:     twd,
+			subtotal: 250, shipping: 60, tax: 12.5, total: 322.5, charged: 322.5,
+		},
+		{
+			name:     "只有數位商品不收運費",
+			items:    []model.CartItem{digitalCartItem(2, 50, 3)},
+			rate:     twd,
+			subtotal: 150, shipping: 0, tax: 7.5, total: 157.5, charged: 157.5,
+		},
+		{
+			name:     "百分比折扣後達門檻免運",
+			items:    []model.CartItem{physicalCartItem(1, 600, 2)},
+			coupon:   &model.Coupon{Code: "SAVE10", Type: enum.CouponTypePercent, Value: 10},
+			rate:     twd,
+			subtotal: 1200, discount: 120, shipping: 0, tax: 54, total: 1134, charged: 1134,
+			couponTag: "SAVE10",
+		},
+		{
+			name:     "免運門檻以折扣後金額計算",
+			items:    []model.CartItem{physicalCartItem(1, 525, 2)},
+			coupon:   &model.Coupon{Code: "MINUS100", Type: enum.CouponTypeFixed, Value: 100},
+			rate:     twd,
+			subtotal: 1050, discount: 100, shipping: 60, tax: 47.5, total: 1057.5, charged: 1057.5,
+			couponTag: "MINUS100",
+		},
+		{
+			name:     "換算付款幣別",
+			items:    []model.CartItem{physicalCartItem(1, 100, 2), digitalCartItem(2, 50, 1)},
+			rate:     currencyRate{Currency: "USD", Rate: 0.03125},
+			subtotal: 250, shipping: 60, tax: 12.5, total: 322.5, charged: 10.08,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checkoutTotals(tt.items, tt.coupon, tt.rate)
+			if err != nil {
+				t.Fatalf("checkoutTotals() error = %v", err)
+			}
+
+			if got.Subtotal != tt.subtotal || got.Discount != tt.discount || got.Shipping != tt.shipping || got.Tax != tt.tax || got.GrandTotal != tt.total {
+				t.Errorf("checkoutTotals() = subtotal %v discount %v shipping %v tax %v total %v, want %v %v %v %v %v",
+					got.Subtotal, got.Discount, got.Shipping, got.Tax, got.GrandTotal,
+					tt.subtotal, tt.discount, tt.shipping, tt.tax, tt.total)
+			}
+			if got.Currency != tt.rate.Currency || got.ChargedAmount != tt.charged {
+				t.Errorf("ChargedAmount = %v %v, want %v %v", got.Currency, got.ChargedAmount, tt.rate.Currency, tt.charged)
+			}
+			if got.CouponCode != tt.couponTag || (got.coupon != nil) != (tt.coupon != nil) {
+				t.Errorf("CouponCode = %q, want %q", got.CouponCode, tt.couponTag)
+			}
+			if len(got.Items) != len(tt.items) {
+				t.Fatalf("len(Items) = %v, want %v", len(got.Items), len(tt.items))
+			}
+			for i, line := range got.Items {
+				want := tt.items[i].UnitPrice * float64(tt.items[i].Quantity)
+				if line.ProductID != tt.items[i].ProductID || line.Amount != want {
+					t.Errorf("Items[%v] = %+v, want product %v amount %v", i, line, tt.items[i].ProductID, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckoutTotalsWithoutEnv(t *testing.T) {
+	t.Setenv("SHIPPING_FEE", "")
+	t.Setenv("SHIPPING_FREE_THRESHOLD", "")
+	t.Setenv("TAX_RATE", "abc")
+
+	got, err := checkoutTotals([]model.CartItem{physicalCartItem(1, 100, 1)}, nil, currencyRate{Currency: "TWD", Rate: 1})
+	if err != nil {
+		t.Fatalf("checkoutTotals() error = %v", err)
+	}
+	if got.Shipping != 0 || got.Tax != 0 || got.GrandTotal != 100 {
+		t.Errorf("checkoutTotals() = shipping %v tax %v total %v, want 0 0 100", got.Shipping, got.Tax, got.GrandTotal)
+	}
+}
+
+func TestCheckoutTotalsCouponError(t *testing.T) {
+	setCheckoutEnv(t)
+
+	coupon := &model.Coupon{Code: "BIG", Type: enum.CouponTypeFixed, Value: 100, MinSubtotal: 500}
+	_, err := checkoutTotals([]model.CartItem{physicalCartItem(1, 100, 2)}, coupon, currencyRate{Currency: "TWD", Rate: 1})
+
+	var couponErr *CouponError
+	if !errors.As(err, &couponErr) {
+		t.Fatalf("checkoutTotals() error = %v, want CouponError", err)
+	}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	limit := uint(3)
+
+	tests := []struct {
+		name     string
+		coupon   model.Coupon
+		subtotal float64
+		want     float64
+		wantErr  string
+	}{
+		{name: "百分比折扣四捨五入", coupon: model.Coupon{Type: enum.CouponTypePercent, Value: 10}, subtotal: 33.33, want: 3.33},
+		{name: "固定金額折扣", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50}, subtotal: 200, want: 50},
+		{name: "固定金額不超過小計", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 500}, subtotal: 200, want: 200},
+		{name: "期間內", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, StartAt: &past, EndAt: &future}, subtotal: 200, want: 50},
+		{name: "剛好達門檻", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, MinSubtotal: 200}, subtotal: 200, want: 50},
+		{name: "尚未開始", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, StartAt: &future}, subtotal: 200, wantErr: "優惠券尚未開始"},
+		{name: "已過期", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, EndAt: &past}, subtotal: 200, wantErr: "優惠券已過期"},
+		{name: "已用完", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, UsageLimit: &limit, UsedCount: 3}, subtotal: 200, wantErr: "優惠券已用完"},
+		{name: "未達門檻", coupon: model.Coupon{Type: enum.CouponTypeFixed, Value: 50, MinSubtotal: 300}, subtotal: 200, wantErr: "未達優惠券使用門檻"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := couponDiscount(tt.coupon, tt.subtotal)
+			if tt.wantErr != "" {
+				var couponErr *CouponError
+				if !errors.As(err, &couponErr) || couponErr.Reason != tt.wantErr {
+					t.Fatalf("couponDiscount() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("couponDiscount() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("couponDiscount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEffectivePrice(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	sale := 80.0
+
+	tests := []struct {
+		name    string
+		product model.Product
+		want    float64
+	}{
+		{name: "沒有特價", product: model.Product{Price: 100}, want: 100},
+		{name: "特價沒有期間", product: model.Product{Price: 100, SalePrice: &sale}, want: 80},
+		{name: "特價期間內", product: model.Product{Price: 100, SalePrice: &sale, SaleStartAt: &past, SaleEndAt: &future}, want: 80},
+		{name: "特價尚未開始", product: model.Product{Price: 100, SalePrice: &sale, SaleStartAt: &future}, want: 100},
+		{name: "特價已結束", product: model.Product{Price: 100, SalePrice: &sale, SaleEndAt: &past}, want: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := effectivePrice(tt.product); got != tt.want {
+				t.Errorf("effectivePrice() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
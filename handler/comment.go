@@ -0,0 +1,548 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddCommentRequest struct {
+	Content string `binding:"required"`
+	Rating  uint   `binding:"required,min=1,max=5"`
+}
+
+type ListCommentsQuery struct {
+	PageQuery
+	Sort string `form:"sort"` // newest, oldest, rating_desc, rating_asc
+}
+
+type ListCommentsResponse struct {
+	List []model.Comment
+	PageInfo
+	Rating model.ProductRating
+}
+
+type ListCommentsByAdminQuery struct {
+	PageQuery
+	Status   string `form:"status"`
+	Reported bool   `form:"reported"`
+}
+
+type ListCommentsByAdminResponse struct {
+	List []model.Comment
+	PageInfo
+}
+
+type ModerateCommentRequest struct {
+	Status string `binding:"required,oneof=approved rejected"`
+}
+
+type ReplyCommentRequest struct {
+	Reply string `binding:"required"`
+}
+
+type ReportCommentRequest struct {
+	Reason string `binding:"required"`
+}
+
+var commentCreatedAtDesc = []pageKey[model.Comment]{
+	{Column: "comment.created_at", Desc: true, Value: func(c model.Comment) any { return c.CreatedAt }},
+	{Column: "comment.id", Desc: true, Value: func(c model.Comment) any { return c.ID }},
+}
+
+var commentSortOptions = map[string]pageOrder[model.Comment]{
+	"":       {Name: "comment_newest", Keys: commentCreatedAtDesc},
+	"newest": {Name: "comment_newest", Keys: commentCreatedAtDesc},
+	"oldest": {Name: "comment_oldest", Keys: []pageKey[model.Comment]{
+		{Column: "comment.created_at", Value: func(c model.Comment) any { return c.CreatedAt }},
+		{Column: "comment.id", Value: func(c model.Comment) any { return c.ID }},
+	}},
+	"rating_desc": {Name: "comment_rating_desc", Keys: append([]pageKey[model.Comment]{
+		{Column: "comment.rating", Desc: true, Value: func(c model.Comment) any { return c.Rating }},
+	}, commentCreatedAtDesc...)},
+	"rating_asc": {Name: "comment_rating_asc", Keys: append([]pageKey[model.Comment]{
+		{Column: "comment.rating", Value: func(c model.Comment) any { return c.Rating }},
+	}, commentCreatedAtDesc...)},
+}
+
+// 審核佇列先進先審
+var commentModerationPageOrder = pageOrder[model.Comment]{
+	Name: "comment_oldest",
+	Keys: []pageKey[model.Comment]{
+		{Column: "comment.created_at", Value: func(c model.Comment) any { return c.CreatedAt }},
+		{Column: "comment.id", Value: func(c model.Comment) any { return c.ID }},
+	},
+}
+
+func AddComment(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 找商品
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err = boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := AddCommentRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 必須買過且已送達才能評價
+	purchased, err := hasDeliveredOrderItem(userID, product.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !purchased {
+		ctx.JSON(http.StatusForbidden, "尚未購買或訂單未送達，無法評價")
+		return
+	}
+
+	// 每個商品只能評價一次
+	var count int64
+	err = boot.DB.Model(&model.Comment{}).
+		Where("user_id = ? AND product_id = ?", userID, product.ID).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		ctx.JSON(http.StatusConflict, "已評價過此商品")
+		return
+	}
+
+	comment := model.Comment{
+		UserID:    userID,
+		ProductID: product.ID,
+		Content:   req.Content,
+		Rating:    req.Rating,
+		Status:    moderateCommentContent(req.Content),
+	}
+	err = boot.DB.Create(&comment).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, comment)
+}
+
+func ListProductComments(ctx *gin.Context) {
+	var query ListCommentsQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, ok := commentSortOptions[query.Sort]
+	if !ok {
+		ctx.JSON(http.StatusBadRequest, "sort is not valid")
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 建立查詢
+	db := boot.DB.Model(&model.Comment{}).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "avatar")
+		}).
+		Where("product_id = ? AND status = ?", product.ID, enum.CommentStatusApproved)
+
+	// 分頁查詢
+	comments, page, err := paginate(db, query.PageQuery, order)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ratings, err := getProductRatings([]uint{product.ID})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListCommentsResponse{
+		List:     comments,
+		PageInfo: page,
+		Rating:   ratings[product.ID],
+	})
+}
+
+// 只能修改自己的評價
+func UpdateComment(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	commentId := ctx.Param("commentId")
+	comment := model.Comment{}
+	err = boot.DB.Where("user_id = ?", userID).First(&comment, commentId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := AddCommentRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 修改後重新審核
+	comment.Content = req.Content
+	comment.Rating = req.Rating
+	comment.Status = moderateCommentContent(req.Content)
+	boot.DB.Save(&comment)
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 使用者只能刪除自己的評價，管理員可刪除任何評價
+func DeleteComment(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	commentId := ctx.Param("commentId")
+	db := boot.DB
+	if !isAdmin(ctx) {
+		db = db.Where("user_id = ?", userID)
+	}
+
+	comment := model.Comment{}
+	err = db.First(&comment, commentId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Delete(&comment).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 檢舉評價，累積到門檻會自動下架等待審核
+func ReportComment(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	commentId := ctx.Param("commentId")
+	comment := model.Comment{}
+	err = boot.DB.Where("status = ?", enum.CommentStatusApproved).First(&comment, commentId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if comment.UserID == userID {
+		ctx.JSON(http.StatusBadRequest, "不能檢舉自己的評價")
+		return
+	}
+
+	req := ReportCommentRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var count int64
+	err = boot.DB.Model(&model.CommentReport{}).
+		Where("comment_id = ? AND user_id = ?", comment.ID, userID).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		ctx.JSON(http.StatusConflict, "已檢舉過此評價")
+		return
+	}
+
+	report := model.CommentReport{
+		CommentID: comment.ID,
+		UserID:    userID,
+		Reason:    req.Reason,
+	}
+	err = boot.DB.Create(&report).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 檢舉數達門檻，改回待審核
+	err = boot.DB.Model(&model.CommentReport{}).Where("comment_id = ?", comment.ID).Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count >= commentReportThreshold() {
+		comment.Status = enum.CommentStatusPending
+		boot.DB.Save(&comment)
+	}
+
+	ctx.JSON(http.StatusOK, "已檢舉")
+}
+
+// 管理員審核佇列，預設顯示待審核評價
+func ListCommentsByAdmin(ctx *gin.Context) {
+	var query ListCommentsByAdminQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 建立查詢
+	db := boot.DB.Model(&model.Comment{}).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "avatar")
+		}).
+		Preload("Reports")
+
+	// 狀態篩選
+	if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	} else if !query.Reported {
+		db = db.Where("status = ?", enum.CommentStatusPending)
+	}
+
+	// 只看被檢舉的評價
+	if query.Reported {
+		db = db.Where("EXISTS (SELECT 1 FROM comment_report WHERE comment_report.comment_id = comment.id)")
+	}
+
+	// 分頁查詢
+	comments, page, err := paginate(db, query.PageQuery, commentModerationPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListCommentsByAdminResponse{
+		List:     comments,
+		PageInfo: page,
+	})
+}
+
+// 核准或退回評價，處理完的檢舉一併清除
+func ModerateComment(ctx *gin.Context) {
+	commentId := ctx.Param("commentId")
+	comment := model.Comment{}
+	err := boot.DB.First(&comment, commentId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := ModerateCommentRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tx := boot.DB.Begin()
+
+	comment.Status = enum.CommentStatus(req.Status)
+	err = tx.Save(&comment).Error
+	if err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = tx.Where("comment_id = ?", comment.ID).Delete(&model.CommentReport{}).Error
+	if err != nil {
+		tx.Rollback()
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tx.Commit()
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 以商店身份公開回覆評價
+func ReplyComment(ctx *gin.Context) {
+	commentId := ctx.Param("commentId")
+	comment := model.Comment{}
+	err := boot.DB.First(&comment, commentId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := ReplyCommentRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := time.Now()
+	comment.Reply = req.Reply
+	comment.RepliedAt = &now
+	boot.DB.Save(&comment)
+
+	ctx.JSON(http.StatusOK, "回覆成功")
+}
+
+// 依審核設定與禁用字決定評價狀態
+// COMMENT_MODERATION=true 時所有評價都需審核，含禁用字的評價一律待審核
+func moderateCommentContent(content string) enum.CommentStatus {
+	lower := strings.ToLower(content)
+	for _, word := range strings.Split(os.Getenv("COMMENT_BANNED_WORDS"), ",") {
+		word = strings.ToLower(strings.TrimSpace(word))
+		if word != "" && strings.Contains(lower, word) {
+			return enum.CommentStatusPending
+		}
+	}
+
+	if os.Getenv("COMMENT_MODERATION") == "true" {
+		return enum.CommentStatusPending
+	}
+
+	return enum.CommentStatusApproved
+}
+
+// 檢舉幾次後自動下架，預設 3 次
+func commentReportThreshold() int64 {
+	threshold, err := strconv.ParseInt(os.Getenv("COMMENT_REPORT_THRESHOLD"), 10, 64)
+	if err != nil || threshold <= 0 {
+		return 3
+	}
+
+	return threshold
+}
+
+// 是否有已送達的訂單包含此商品
+func hasDeliveredOrderItem(userID uint, productID uint) (bool, error) {
+	var count int64
+	err := boot.DB.Model(&model.OrderItem{}).
+		Joins(`JOIN "order" ON "order".id = order_item.order_id`).
+		Where(`"order".user_id = ? AND "order".status = ? AND order_item.product_id = ?`,
+			userID, enum.OrderStatusDelivered, productID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// 計算多個商品的平均評分與星等分佈
+func getProductRatings(productIDs []uint) (map[uint]model.ProductRating, error) {
+	type row struct {
+		ProductID uint
+		Rating    uint
+		Count     int64
+	}
+
+	var rows []row
+	err := boot.DB.Model(&model.Comment{}).
+		Select("product_id, rating, COUNT(*) AS count").
+		Where("product_id IN ? AND status = ?", productIDs, enum.CommentStatusApproved).
+		Group("product_id, rating").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[uint]model.ProductRating, len(productIDs))
+	for _, id := range productIDs {
+		ratings[id] = model.ProductRating{Distribution: map[uint]int64{1: 0, 2: 0, 3: 0, 4: 0, 5: 0}}
+	}
+
+	sums := make(map[uint]uint64, len(productIDs))
+	for _, r := range rows {
+		rating := ratings[r.ProductID]
+		rating.Count += r.Count
+		rating.Distribution[r.Rating] += r.Count
+		ratings[r.ProductID] = rating
+		sums[r.ProductID] += uint64(r.Rating) * uint64(r.Count)
+	}
+
+	for id, rating := range ratings {
+		if rating.Count > 0 {
+			rating.Average = math.Round(float64(sums[id])/float64(rating.Count)*10) / 10
+			ratings[id] = rating
+		}
+	}
+
+	return ratings, nil
+}
+
+// 把評分統計填入商品
+func fillProductRatings(products []model.Product) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, 0, len(products))
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+
+	ratings, err := getProductRatings(ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range products {
+		products[i].Rating = ratings[products[i].ID]
+	}
+
+	return nil
+}
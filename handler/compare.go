@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type CompareProductsQuery struct {
+	IDs string `form:"ids" binding:"required"` // 逗號分隔的商品 id
+}
+
+type CompareProductColumn struct {
+	ID       uint
+	Name     string
+	ImageURL string
+}
+
+type CompareRow struct {
+	Field     string
+	Values    []any // 順序和 Products 相同
+	Different bool  // 商品之間的值不同
+}
+
+type CompareProductsResponse struct {
+	Products []CompareProductColumn
+	Rows     []CompareRow
+}
+
+const maxCompareProducts = 4
+
+// 並排比較商品，最多 maxCompareProducts 個
+func CompareProducts(ctx *gin.Context) {
+	var query CompareProductsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 解析 id，去除重複並保留順序
+	var ids []uint
+	seen := map[uint]bool{}
+	for _, s := range strings.Split(query.IDs, ",") {
+		id, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+		if err != nil || id == 0 {
+			ctx.JSON(http.StatusBadRequest, "ids is not valid")
+			return
+		}
+		if !seen[uint(id)] {
+			seen[uint(id)] = true
+			ids = append(ids, uint(id))
+		}
+	}
+	if len(ids) < 2 || len(ids) > maxCompareProducts {
+		ctx.JSON(http.StatusBadRequest, fmt.Sprintf("請選擇 2 到 %v 個商品", maxCompareProducts))
+		return
+	}
+
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var found []model.Product
+	db := boot.DB.Preload("Category").Where("id IN ?", ids)
+	if !isAdmin(ctx) {
+		db = db.Where("status = ?", enum.ProductStatusPublished)
+	}
+	err = db.Find(&found).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(found) != len(ids) {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 依傳入順序排列
+	byID := map[uint]model.Product{}
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	products := make([]model.Product, len(ids))
+	for i, id := range ids {
+		products[i] = byID[id]
+	}
+
+	err = fillProductRatings(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	fillProductPrices(products, rate)
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 比較欄位
+	fields := []struct {
+		name  string
+		value func(p model.Product) any
+	}{
+		{"Category", func(p model.Product) any { return p.Category.Name }},
+		{"Price", func(p model.Product) any { return p.DisplayPrice }},
+		{"Currency", func(p model.Product) any { return p.Currency }},
+		{"StockStatus", func(p model.Product) any { return stockStatus(p) }},
+		{"RatingAverage", func(p model.Product) any { return p.Rating.Average }},
+		{"RatingCount", func(p model.Product) any { return p.Rating.Count }},
+		{"IsBundle", func(p model.Product) any { return p.IsBundle }},
+		{"IsDigital", func(p model.Product) any { return p.IsDigital }},
+		{"Description", func(p model.Product) any { return p.Description }},
+	}
+
+	res := CompareProductsResponse{}
+	for _, p := range products {
+		res.Products = append(res.Products, CompareProductColumn{
+			ID:       p.ID,
+			Name:     p.Name,
+			ImageURL: p.ImageURL,
+		})
+	}
+	for _, field := range fields {
+		row := CompareRow{Field: field.name}
+		for _, p := range products {
+			value := field.value(p)
+			if len(row.Values) > 0 && !reflect.DeepEqual(row.Values[0], value) {
+				row.Different = true
+			}
+			row.Values = append(row.Values, value)
+		}
+		res.Rows = append(res.Rows, row)
+	}
+
+	ctx.JSON(http.StatusOK, res)
+}
+
+// 庫存狀態：數位商品不限量，其餘依低庫存門檻判斷
+func stockStatus(product model.Product) string {
+	if product.IsDigital {
+		return "in_stock"
+	}
+	if product.StockQuantity == 0 {
+		return "out_of_stock"
+	}
+
+	var threshold uint
+	if product.Category.LowStockThreshold != nil {
+		threshold = *product.Category.LowStockThreshold
+	}
+	if product.LowStockThreshold != nil {
+		threshold = *product.LowStockThreshold
+	}
+	if product.StockQuantity <= threshold {
+		return "low_stock"
+	}
+
+	return "in_stock"
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddCouponRequest struct {
+	Code        string          `binding:"required"`
+	Type        enum.CouponType `binding:"required,oneof=percent fixed"`
+	Value       float64         `binding:"required,gt=0"`
+	MinSubtotal float64         `binding:"min=0"`
+	StartAt     *time.Time
+	EndAt       *time.Time
+	UsageLimit  *uint
+}
+
+type ListCouponsResponse struct {
+	List []model.Coupon
+	PageInfo
+}
+
+// 優惠券無法使用
+type CouponError struct {
+	Reason string
+}
+
+func (e *CouponError) Error() string {
+	return e.Reason
+}
+
+// 新優惠券在前
+var couponPageOrder = pageOrder[model.Coupon]{
+	Name: "coupon_newest",
+	Keys: []pageKey[model.Coupon]{
+		{Column: "coupon.id", Desc: true, Value: func(c model.Coupon) any { return c.ID }},
+	},
+}
+
+func ListCoupons(ctx *gin.Context) {
+	var query PageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	coupons, page, err := paginate(boot.DB.Model(&model.Coupon{}), query, couponPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListCouponsResponse{
+		List:     coupons,
+		PageInfo: page,
+	})
+}
+
+func AddCoupon(ctx *gin.Context) {
+	req := AddCouponRequest{}
+	err := ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Type == enum.CouponTypePercent && req.Value > 100 {
+		ctx.JSON(http.StatusBadRequest, "百分比折扣不能超過 100")
+		return
+	}
+	if req.StartAt != nil && req.EndAt != nil && !req.EndAt.After(*req.StartAt) {
+		ctx.JSON(http.StatusBadRequest, "結束時間必須晚於開始時間")
+		return
+	}
+
+	coupon := model.Coupon{
+		Code:        normalizeCouponCode(req.Code),
+		Type:        req.Type,
+		Value:       req.Value,
+		MinSubtotal: req.MinSubtotal,
+		StartAt:     req.StartAt,
+		EndAt:       req.EndAt,
+		UsageLimit:  req.UsageLimit,
+	}
+	err = boot.DB.Create(&coupon).Error
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, coupon)
+}
+
+func DeleteCoupon(ctx *gin.Context) {
+	couponId := ctx.Param("couponId")
+	err := boot.DB.Delete(&model.Coupon{}, couponId).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 優惠碼不分大小寫
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// 檢查優惠券可否用在這個小計，回傳折扣金額
+func couponDiscount(coupon model.Coupon, subtotal float64) (float64, error) {
+	now := time.Now()
+	if coupon.StartAt != nil && now.Before(*coupon.StartAt) {
+		return 0, &CouponError{Reason: "優惠券尚未開始"}
+	}
+	if coupon.EndAt != nil && !now.Before(*coupon.EndAt) {
+		return 0, &CouponError{Reason: "優惠券已過期"}
+	}
+	if coupon.UsageLimit != nil && coupon.UsedCount >= *coupon.UsageLimit {
+		return 0, &CouponError{Reason: "優惠券已用完"}
+	}
+	if subtotal < coupon.MinSubtotal {
+		return 0, &CouponError{Reason: "未達優惠券使用門檻"}
+	}
+
+	if coupon.Type == enum.CouponTypePercent {
+		return roundAmount(subtotal * coupon.Value / 100), nil
+	}
+
+	return min(coupon.Value, subtotal), nil
+}
@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type UpdateExchangeRateRequest struct {
+	Rate float64 `binding:"required,gt=0"`
+}
+
+type ListExchangeRatesResponse struct {
+	BaseCurrency string
+	List         []model.ExchangeRate
+}
+
+// 目前請求使用的幣別與匯率
+type currencyRate struct {
+	Currency string
+	Rate     float64
+}
+
+var currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+var errCurrencyNotSupported = errors.New("currency not supported")
+
+func ListExchangeRates(ctx *gin.Context) {
+	rates := []model.ExchangeRate{}
+	err := boot.DB.Order("currency ASC").Find(&rates).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListExchangeRatesResponse{
+		BaseCurrency: baseCurrency(),
+		List:         rates,
+	})
+}
+
+// 新增或更新單一幣別匯率
+func UpdateExchangeRate(ctx *gin.Context) {
+	currency := strings.ToUpper(ctx.Param("currency"))
+	if !currencyPattern.MatchString(currency) || currency == baseCurrency() {
+		ctx.JSON(http.StatusBadRequest, "currency is not valid")
+		return
+	}
+
+	req := UpdateExchangeRateRequest{}
+	err := ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = upsertExchangeRate(boot.DB, currency, req.Rate)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+func DeleteExchangeRate(ctx *gin.Context) {
+	currency := strings.ToUpper(ctx.Param("currency"))
+	err := boot.DB.Where("currency = ?", currency).Delete(&model.ExchangeRate{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 離線環境手動匯入匯率，上傳 CSV，每行「幣別,匯率」
+func ImportExchangeRates(ctx *gin.Context) {
+	file, err := ctx.FormFile("UploadedFile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	defer src.Close()
+
+	// 先全部解析，有錯就整批不匯入
+	rates := map[string]float64{}
+	reader := csv.NewReader(src)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(record[0]))
+		if line == 1 && currency == "CURRENCY" {
+			continue // 標題列
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(record[1]), 64)
+		if !currencyPattern.MatchString(currency) || currency == baseCurrency() || err != nil || rate <= 0 {
+			ctx.JSON(http.StatusBadRequest, fmt.Sprintf("line %v is not valid", line))
+			return
+		}
+		rates[currency] = rate
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		for currency, rate := range rates {
+			err := upsertExchangeRate(tx, currency, rate)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, fmt.Sprintf("已匯入 %v 筆匯率", len(rates)))
+}
+
+// 基準幣，由 BASE_CURRENCY 設定（預設 TWD）
+func baseCurrency() string {
+	currency := strings.ToUpper(os.Getenv("BASE_CURRENCY"))
+	if currency == "" {
+		return "TWD"
+	}
+
+	return currency
+}
+
+// 從 query currency 或 X-Currency header 決定幣別，沒指定用基準幣
+func resolveCurrency(ctx *gin.Context) (currencyRate, error) {
+	currency := ctx.Query("currency")
+	if currency == "" {
+		currency = ctx.GetHeader("X-Currency")
+	}
+
+	return lookupCurrency(currency)
+}
+
+// 查幣別匯率，空字串或基準幣匯率為 1
+func lookupCurrency(currency string) (currencyRate, error) {
+	currency = strings.ToUpper(currency)
+	if currency == "" || currency == baseCurrency() {
+		return currencyRate{Currency: baseCurrency(), Rate: 1}, nil
+	}
+
+	rate := model.ExchangeRate{}
+	err := boot.DB.Where("currency = ?", currency).First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return currencyRate{}, errCurrencyNotSupported
+	}
+	if err != nil {
+		return currencyRate{}, err
+	}
+
+	return currencyRate{Currency: rate.Currency, Rate: rate.Rate}, nil
+}
+
+// 換算並四捨五入到小數兩位
+func (c currencyRate) convert(amount float64) float64 {
+	return math.Round(amount*c.Rate*100) / 100
+}
+
+// 把商品價格換算成顯示幣別
+func fillProductPrices(products []model.Product, rate currencyRate) {
+	for i := range products {
+		products[i].Currency = rate.Currency
+		products[i].DisplayPrice = rate.convert(effectivePrice(products[i]))
+	}
+}
+
+// 把購物車單價換算成顯示幣別
+func fillCartItemPrices(items []model.CartItem, rate currencyRate) {
+	for i := range items {
+		items[i].Currency = rate.Currency
+		items[i].DisplayUnitPrice = rate.convert(items[i].UnitPrice)
+		items[i].Product.Currency = rate.Currency
+		items[i].Product.DisplayPrice = rate.convert(effectivePrice(items[i].Product))
+	}
+}
+
+func upsertExchangeRate(db *gorm.DB, currency string, rate float64) error {
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&model.ExchangeRate{Currency: currency, Rate: rate}).Error
+}
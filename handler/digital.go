@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type DigitalDownloadResponse struct {
+	OrderItemID        uint
+	ProductID          uint
+	Name               string
+	URL                string
+	ExpiresAt          time.Time
+	RemainingDownloads uint
+}
+
+var errDownloadsUsedUp = errors.New("下載次數已用完")
+
+// 付款後才可下載的訂單狀態
+var paidOrderStatuses = []enum.OrderStatus{
+	enum.OrderStatusPaid,
+	enum.OrderStatusProcessing,
+	enum.OrderStatusShipped,
+	enum.OrderStatusDelivered,
+}
+
+// 上傳數位商品檔案，存在 bucket 的 private/ 底下
+func UpdateProductDigitalFile(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	file, err := ctx.FormFile("UploadedFile")
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	ext := filepath.Ext(file.Filename)
+	file.Filename = "private/" + uuid.New().String() + ext
+
+	err = boot.UploadFile(ctx, file)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 舊檔刪除失敗不影響結果
+	if product.DigitalFile != "" {
+		err = boot.DeleteFile(ctx, product.DigitalFile)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	// 存 DB
+	product.IsDigital = true
+	product.DigitalFile = file.Filename
+	boot.DB.Model(&product).Select("is_digital", "digital_file").Updates(&product)
+
+	ctx.JSON(http.StatusOK, "數位檔案更新成功")
+}
+
+// 取消數位商品
+func DeleteProductDigitalFile(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	if product.DigitalFile != "" {
+		err = boot.DeleteFile(ctx, product.DigitalFile)
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	product.IsDigital = false
+	product.DigitalFile = ""
+	boot.DB.Model(&product).Select("is_digital", "digital_file").Updates(&product)
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 買家取得訂單中數位商品的下載連結，未過期的連結會沿用
+func ListOrderDownloads(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	orderId := ctx.Param("orderId")
+	order := model.Order{}
+	err = boot.DB.Preload("OrderItems.Product").
+		Where("user_id = ?", userID).
+		First(&order, orderId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if !slices.Contains(paidOrderStatuses, order.Status) {
+		ctx.JSON(http.StatusForbidden, "訂單尚未付款")
+		return
+	}
+
+	ttl, err := time.ParseDuration(os.Getenv("DIGITAL_DOWNLOAD_TTL"))
+	if err != nil || ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+
+	downloads := []DigitalDownloadResponse{}
+	for _, item := range order.OrderItems {
+		if !item.Product.IsDigital {
+			continue
+		}
+
+		link, err := issueDownloadLink(item, userID, ttl)
+		if errors.Is(err, errDownloadsUsedUp) {
+			continue
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		downloads = append(downloads, DigitalDownloadResponse{
+			OrderItemID:        item.ID,
+			ProductID:          item.ProductID,
+			Name:               item.Product.Name,
+			URL:                "/api/download/" + link.Token,
+			ExpiresAt:          link.ExpiresAt,
+			RemainingDownloads: link.MaxDownloads - link.DownloadCount,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, downloads)
+}
+
+// 下載數位商品，只有買家本人、未過期、次數未用完才能下載
+func DownloadDigitalFile(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	token := ctx.Param("token")
+	link := model.DigitalDownload{}
+	err = boot.DB.Where("token = ? AND user_id = ?", token, userID).First(&link).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if time.Now().After(link.ExpiresAt) {
+		ctx.JSON(http.StatusGone, "下載連結已過期")
+		return
+	}
+
+	product := model.Product{}
+	err = boot.DB.First(&product, link.ProductID).Error
+	if err != nil || product.DigitalFile == "" {
+		ctx.JSON(http.StatusNotFound, "file not found")
+		return
+	}
+
+	// 先扣次數，搶到才下載
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		used, err := lockDownloadUsage(tx, link.OrderItemID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= digitalDownloadLimit() {
+			return errDownloadsUsedUp
+		}
+
+		result := tx.Model(&model.DigitalDownload{}).
+			Where("id = ? AND download_count < max_downloads", link.ID).
+			UpdateColumn("download_count", gorm.Expr("download_count + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDownloadsUsedUp
+		}
+		return nil
+	})
+	if errors.Is(err, errDownloadsUsedUp) {
+		ctx.JSON(http.StatusGone, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reader, err := boot.OpenFile(ctx, product.DigitalFile)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer reader.Close()
+
+	filename := product.Name + filepath.Ext(product.DigitalFile)
+	ctx.DataFromReader(http.StatusOK, reader.Attrs.Size, reader.Attrs.ContentType, reader, map[string]string{
+		"Content-Disposition": fmt.Sprintf("attachment; filename*=UTF-8''%v", url.PathEscape(filename)),
+	})
+}
+
+// 每個訂單細項的下載次數上限，所有連結共用
+func digitalDownloadLimit() uint {
+	limit, err := strconv.ParseUint(os.Getenv("DIGITAL_DOWNLOAD_LIMIT"), 10, 64)
+	if err != nil || limit == 0 {
+		limit = 5
+	}
+
+	return uint(limit)
+}
+
+// 鎖定訂單細項後加總所有連結已下載的次數，同一細項的發連結與下載會排隊
+// 必須在交易中呼叫
+func lockDownloadUsage(tx *gorm.DB, orderItemID uint, userID uint) (uint, error) {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&model.OrderItem{}, orderItemID).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	err = tx.Model(&model.DigitalDownload{}).
+		Select("COALESCE(SUM(download_count), 0)").
+		Where("order_item_id = ? AND user_id = ?", orderItemID, userID).
+		Scan(&used).Error
+	return uint(used), err
+}
+
+// 沿用未過期且還有次數的連結，否則用剩餘次數發新連結
+func issueDownloadLink(item model.OrderItem, userID uint, ttl time.Duration) (model.DigitalDownload, error) {
+	link := model.DigitalDownload{}
+	err := boot.DB.Transaction(func(tx *gorm.DB) error {
+		used, err := lockDownloadUsage(tx, item.ID, userID)
+		if err != nil {
+			return err
+		}
+		limit := digitalDownloadLimit()
+		if used >= limit {
+			return errDownloadsUsedUp
+		}
+
+		err = tx.Where("order_item_id = ? AND user_id = ?", item.ID, userID).
+			Order("id DESC").
+			Limit(1).
+			Find(&link).Error
+		if err != nil {
+			return err
+		}
+		if link.ID != 0 && link.ExpiresAt.After(time.Now()) && link.DownloadCount < link.MaxDownloads {
+			return nil
+		}
+
+		token, err := newDownloadToken()
+		if err != nil {
+			return err
+		}
+
+		link = model.DigitalDownload{
+			OrderItemID:  item.ID,
+			UserID:       userID,
+			ProductID:    item.ProductID,
+			Token:        token,
+			ExpiresAt:    time.Now().Add(ttl),
+			MaxDownloads: limit - used,
+		}
+		return tx.Create(&link).Error
+	})
+
+	return link, err
+}
+
+func newDownloadToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,691 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type OutOfStockItem struct {
+	ProductID uint
+	Name      string
+	Requested uint
+	Available uint
+}
+
+type OutOfStockResponse struct {
+	Message string
+	Items   []OutOfStockItem
+}
+
+type AdjustStockRequest struct {
+	Type        string `binding:"required,oneof=adjustment return"`
+	Change      int    `binding:"required"`
+	Reason      string `binding:"required"`
+	WarehouseID *uint  // 沒填用預設倉庫
+}
+
+type ListStockMovementsQuery struct {
+	PageQuery
+	Type string `form:"type"`
+}
+
+type ListStockMovementsResponse struct {
+	List []model.StockMovement
+	PageInfo
+}
+
+type ListLowStockProductsQuery struct {
+	PageQuery
+	CategoryID uint `form:"categoryId"`
+}
+
+type StockReconcileResponse struct {
+	ProductID      uint
+	StockQuantity  uint
+	LedgerQuantity int64 // 流水帳加總
+	Difference     int64 // 庫存 - 流水帳加總
+}
+
+// 庫存不足時回傳每個商品的需求量與剩餘量
+type OutOfStockError struct {
+	Items []OutOfStockItem
+}
+
+func (e *OutOfStockError) Error() string {
+	return "庫存不足"
+}
+
+var errNegativeStock = errors.New("庫存不能小於 0")
+
+// 一次操作中商品的總庫存變化，Before 是第一筆異動前，After 是最後一筆異動後
+type stockLevel struct {
+	Before uint
+	After  uint
+}
+
+// 商品 => 庫存變化，在交易中由 changeStock 記錄，commit 後用來判斷低庫存
+type stockLevels map[uint]*stockLevel
+
+func (l stockLevels) record(productID uint, before uint, after uint) {
+	if l == nil {
+		return
+	}
+	if level, ok := l[productID]; ok {
+		level.After = after
+		return
+	}
+	l[productID] = &stockLevel{Before: before, After: after}
+}
+
+// 操作前高於門檻、操作後低於等於門檻
+func (l *stockLevel) crossedBelow(threshold uint) bool {
+	return l != nil && l.Before > threshold && l.After <= threshold
+}
+
+// 流水帳新的在前
+var stockMovementPageOrder = pageOrder[model.StockMovement]{
+	Name: "stock_movement_id_desc",
+	Keys: []pageKey[model.StockMovement]{
+		{Column: "stock_movement.id", Desc: true, Value: func(m model.StockMovement) any { return m.ID }},
+	},
+}
+
+// 庫存少的排前面
+var lowStockPageOrder = pageOrder[model.Product]{
+	Name: "product_stock_asc",
+	Keys: []pageKey[model.Product]{
+		{Column: "product.stock_quantity", Value: func(p model.Product) any { return p.StockQuantity }},
+		{Column: "product.id", Value: func(p model.Product) any { return p.ID }},
+	},
+}
+
+// 手動調整庫存（盤點、退貨入庫等）
+func AdjustStock(ctx *gin.Context) {
+	operatorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err = boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := AdjustStockRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if req.WarehouseID != nil {
+		err = boot.DB.First(&model.Warehouse{}, *req.WarehouseID).Error
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, "warehouse not found")
+			return
+		}
+	}
+
+	levels := stockLevels{}
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		return changeStock(tx, levels, model.StockMovement{
+			ProductID:   product.ID,
+			Type:        enum.StockMovementType(req.Type),
+			Change:      req.Change,
+			Reason:      req.Reason,
+			WarehouseID: req.WarehouseID,
+			OperatorID:  &operatorID,
+		})
+	})
+	if errors.Is(err, errNegativeStock) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	go notifyStockChange([]uint{product.ID}, levels)
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+func ListStockMovements(ctx *gin.Context) {
+	var query ListStockMovementsQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+
+	// 建立查詢
+	db := boot.DB.Model(&model.StockMovement{}).Where("product_id = ?", productId)
+
+	// 類型篩選
+	if query.Type != "" {
+		db = db.Where("type = ?", query.Type)
+	}
+
+	// 分頁查詢
+	movements, page, err := paginate(db, query.PageQuery, stockMovementPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListStockMovementsResponse{
+		List:     movements,
+		PageInfo: page,
+	})
+}
+
+// 比對目前庫存與流水帳加總
+func GetStockReconcile(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	ledger, err := sumStockMovements(boot.DB, product.ID)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, StockReconcileResponse{
+		ProductID:      product.ID,
+		StockQuantity:  product.StockQuantity,
+		LedgerQuantity: ledger,
+		Difference:     int64(product.StockQuantity) - ledger,
+	})
+}
+
+// 補一筆對帳紀錄讓流水帳加總等於目前庫存，庫存本身不變
+// 用於流水帳上線前就存在的商品
+func ReconcileStock(ctx *gin.Context) {
+	operatorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err = boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		product, err := lockProduct(tx, product.ID)
+		if err != nil {
+			return err
+		}
+
+		ledger, err := sumStockMovements(tx, product.ID)
+		if err != nil {
+			return err
+		}
+
+		difference := int64(product.StockQuantity) - ledger
+		if difference == 0 {
+			return nil
+		}
+
+		return tx.Create(&model.StockMovement{
+			ProductID:    product.ID,
+			Type:         enum.StockMovementReconcile,
+			Change:       int(difference),
+			BalanceAfter: product.StockQuantity,
+			OperatorID:   &operatorID,
+		}).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "對帳完成")
+}
+
+// 庫存小於等於門檻的商品，門檻優先用商品設定，沒有則用種類預設
+func ListLowStockProducts(ctx *gin.Context) {
+	var query ListLowStockProductsQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// 建立查詢
+	db := boot.DB.Model(&model.Product{}).
+		Preload("Category").
+		Where("product.is_bundle = ?", false).
+		Where("product.stock_quantity <= COALESCE(product.low_stock_threshold, (SELECT category.low_stock_threshold FROM category WHERE category.id = product.category_id))")
+
+	// 如果有分類，加入分類篩選
+	if query.CategoryID != 0 {
+		db = db.Where("product.category_id = ?", query.CategoryID)
+	}
+
+	// 分頁查詢
+	products, page, err := paginate(db, query.PageQuery, lowStockPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListProductsResponse{
+		List:     products,
+		PageInfo: page,
+	})
+}
+
+// 整個操作前後庫存跌破門檻的商品通知管理員
+// 在交易 commit 後呼叫，避免 rollback 造成誤報
+func notifyLowStock(levels stockLevels) {
+	if len(levels) == 0 {
+		return
+	}
+
+	type row struct {
+		ID        uint
+		Name      string
+		Threshold uint
+	}
+
+	var rows []row
+	err := boot.DB.Raw(`
+		SELECT product.id, product.name,
+			COALESCE(product.low_stock_threshold, category.low_stock_threshold) AS threshold
+		FROM product
+		JOIN category ON category.id = product.category_id
+		WHERE product.id IN ?`,
+		slices.Collect(maps.Keys(levels)),
+	).Scan(&rows).Error
+	if err != nil {
+		log.Println("Check low stock failed:", err)
+		return
+	}
+
+	for _, r := range rows {
+		level := levels[r.ID]
+		if !level.crossedBelow(r.Threshold) {
+			continue
+		}
+
+		err := boot.Notify(context.Background(), boot.Notification{
+			Type:    "low_stock",
+			Subject: "低庫存提醒",
+			Message: fmt.Sprintf("%v 庫存剩 %v（門檻 %v）", r.Name, level.After, r.Threshold),
+			Data: map[string]any{
+				"ProductID":     r.ID,
+				"StockQuantity": level.After,
+				"Threshold":     r.Threshold,
+			},
+		})
+		if err != nil {
+			log.Println("Send low stock notification failed:", err)
+		}
+	}
+}
+
+// 鎖定商品列，檢查總庫存後依分倉策略扣各倉庫存，任一商品不足則整批失敗
+// 組合商品會展開成組成商品扣庫存，數位商品不扣庫存
+// items 需已建立（有 ID），必須在交易中呼叫
+func reserveStock(tx *gorm.DB, levels stockLevels, orderID uint, items []model.OrderItem, location *shippingLocation) error {
+	items, err := expandBundleItems(tx, items)
+	if err != nil {
+		return err
+	}
+
+	items, err = excludeDigitalItems(tx, items)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+
+	quantities, productIDs := sumItemQuantities(items)
+
+	// 依 id 排序鎖定，避免死結
+	slices.Sort(productIDs)
+	outOfStock := &OutOfStockError{}
+	for _, id := range productIDs {
+		product, err := lockProduct(tx, id)
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// 停用倉庫不出貨
+		inactive, err := inactiveWarehouseStock(tx, id)
+		if err != nil {
+			return err
+		}
+		available := sellableQuantity(product.StockQuantity, inactive)
+		if available < quantities[id] {
+			outOfStock.Items = append(outOfStock.Items, OutOfStockItem{
+				ProductID: id,
+				Name:      product.Name,
+				Requested: quantities[id],
+				Available: available,
+			})
+		}
+	}
+	if len(outOfStock.Items) > 0 {
+		return outOfStock
+	}
+
+	// 分配倉庫
+	allocations, err := allocateWarehouses(tx, items, location)
+	if err != nil {
+		return err
+	}
+
+	for _, allocation := range allocations {
+		err = tx.Create(&allocation).Error
+		if err != nil {
+			return err
+		}
+
+		err = changeStock(tx, levels, model.StockMovement{
+			ProductID:   allocation.ProductID,
+			Type:        enum.StockMovementSale,
+			Change:      -int(allocation.Quantity),
+			OrderID:     &orderID,
+			WarehouseID: &allocation.WarehouseID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// 每個商品的訂購總數，productIDs 依第一次出現的順序
+func sumItemQuantities(items []model.OrderItem) (map[uint]uint, []uint) {
+	quantities := map[uint]uint{}
+	var productIDs []uint
+	for _, item := range items {
+		if _, ok := quantities[item.ProductID]; !ok {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		quantities[item.ProductID] += item.Quantity
+	}
+
+	return quantities, productIDs
+}
+
+// 總庫存扣掉停用倉庫的庫存，停用倉庫的帳不會讓結果小於 0
+func sellableQuantity(stock uint, inactive uint) uint {
+	return stock - min(inactive, stock)
+}
+
+// 把組合商品的訂單細項換成組成商品，ID 保留原訂單細項
+func expandBundleItems(tx *gorm.DB, items []model.OrderItem) ([]model.OrderItem, error) {
+	var productIDs []uint
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var components []model.BundleComponent
+	err := tx.Joins("JOIN product ON product.id = bundle_component.bundle_id").
+		Where("bundle_component.bundle_id IN ? AND product.is_bundle = ?", productIDs, true).
+		Find(&components).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return items, nil
+	}
+
+	bundles := map[uint][]model.BundleComponent{}
+	for _, component := range components {
+		bundles[component.BundleID] = append(bundles[component.BundleID], component)
+	}
+
+	var expanded []model.OrderItem
+	for _, item := range items {
+		components, ok := bundles[item.ProductID]
+		if !ok {
+			expanded = append(expanded, item)
+			continue
+		}
+
+		for _, component := range components {
+			expanded = append(expanded, model.OrderItem{
+				ID:        item.ID,
+				ProductID: component.ComponentID,
+				Quantity:  item.Quantity * component.Quantity,
+			})
+		}
+	}
+
+	return expanded, nil
+}
+
+// 移除數位商品的訂單細項
+func excludeDigitalItems(tx *gorm.DB, items []model.OrderItem) ([]model.OrderItem, error) {
+	if len(items) == 0 {
+		return items, nil
+	}
+
+	var productIDs []uint
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	var digitalIDs []uint
+	err := tx.Model(&model.Product{}).
+		Where("id IN ? AND is_digital = ?", productIDs, true).
+		Pluck("id", &digitalIDs).Error
+	if err != nil || len(digitalIDs) == 0 {
+		return items, err
+	}
+
+	var physical []model.OrderItem
+	for _, item := range items {
+		if !slices.Contains(digitalIDs, item.ProductID) {
+			physical = append(physical, item)
+		}
+	}
+
+	return physical, nil
+}
+
+// 訂單取消時把庫存加回原出貨倉庫，舊訂單沒有分倉紀錄則加回預設倉庫，數位商品略過
+// items 需 Preload Allocations，必須在交易中呼叫
+func restoreStock(tx *gorm.DB, levels stockLevels, orderID uint, items []model.OrderItem) error {
+	// 沒有分倉紀錄的細項，數位商品本來就沒扣庫存
+	var legacy []model.OrderItem
+	for _, item := range items {
+		if len(item.Allocations) == 0 {
+			legacy = append(legacy, item)
+		}
+	}
+	legacy, err := excludeDigitalItems(tx, legacy)
+	if err != nil {
+		return err
+	}
+	for _, item := range legacy {
+		err := changeStock(tx, levels, model.StockMovement{
+			ProductID: item.ProductID,
+			Type:      enum.StockMovementCancelRestock,
+			Change:    int(item.Quantity),
+			OrderID:   &orderID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, item := range items {
+		for _, allocation := range item.Allocations {
+			productID := allocation.ProductID
+			if productID == 0 {
+				productID = item.ProductID
+			}
+
+			err := changeStock(tx, levels, model.StockMovement{
+				ProductID:   productID,
+				Type:        enum.StockMovementCancelRestock,
+				Change:      int(allocation.Quantity),
+				OrderID:     &orderID,
+				WarehouseID: &allocation.WarehouseID,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// 依異動量調整庫存並寫入流水帳，沒指定倉庫時用預設倉庫
+// 庫存變化記錄到 levels，不需要低庫存通知時傳 nil；必須在交易中呼叫
+func changeStock(tx *gorm.DB, levels stockLevels, movement model.StockMovement) error {
+	product, err := lockProduct(tx, movement.ProductID)
+	if err != nil {
+		return err
+	}
+
+	if movement.WarehouseID == nil {
+		warehouse, err := defaultWarehouse(tx)
+		if err != nil {
+			return err
+		}
+		movement.WarehouseID = &warehouse.ID
+	}
+
+	stock, err := lockWarehouseStock(tx, *movement.WarehouseID, product.ID)
+	if err != nil {
+		return err
+	}
+
+	err = applyStockMovement(tx, product, stock, movement)
+	if err != nil {
+		return err
+	}
+
+	levels.record(product.ID, product.StockQuantity, uint(int(product.StockQuantity)+movement.Change))
+	return nil
+}
+
+// 直接設定總庫存數量，差額加減在預設倉庫並寫入流水帳
+// 必須在交易中呼叫
+func setStock(tx *gorm.DB, levels stockLevels, productID uint, quantity uint, movement model.StockMovement) error {
+	product, err := lockProduct(tx, productID)
+	if err != nil {
+		return err
+	}
+
+	movement.ProductID = productID
+	movement.Change = int(quantity) - int(product.StockQuantity)
+	if movement.Change == 0 {
+		return nil
+	}
+
+	return changeStock(tx, levels, movement)
+}
+
+// 鎖定商品列，並把分倉前的舊庫存補進預設倉庫
+func lockProduct(tx *gorm.DB, productID uint) (model.Product, error) {
+	product := model.Product{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+	if err != nil {
+		return product, err
+	}
+
+	var sum int64
+	err = tx.Model(&model.WarehouseStock{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("product_id = ?", product.ID).
+		Scan(&sum).Error
+	if err != nil || int64(product.StockQuantity) <= sum {
+		return product, err
+	}
+
+	warehouse, err := defaultWarehouse(tx)
+	if err != nil {
+		return product, err
+	}
+
+	stock, err := lockWarehouseStock(tx, warehouse.ID, product.ID)
+	if err != nil {
+		return product, err
+	}
+
+	err = tx.Model(&stock).Update("quantity", stock.Quantity+uint(int64(product.StockQuantity)-sum)).Error
+	return product, err
+}
+
+func lockWarehouseStock(tx *gorm.DB, warehouseID uint, productID uint) (model.WarehouseStock, error) {
+	stock := model.WarehouseStock{WarehouseID: warehouseID, ProductID: productID}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("warehouse_id = ? AND product_id = ?", warehouseID, productID).
+		FirstOrCreate(&stock).Error
+	return stock, err
+}
+
+func applyStockMovement(tx *gorm.DB, product model.Product, stock model.WarehouseStock, movement model.StockMovement) error {
+	balance := int(product.StockQuantity) + movement.Change
+	quantity := int(stock.Quantity) + movement.Change
+	if balance < 0 || quantity < 0 {
+		return errNegativeStock
+	}
+
+	err := tx.Model(&product).Update("stock_quantity", uint(balance)).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&stock).Update("quantity", uint(quantity)).Error
+	if err != nil {
+		return err
+	}
+
+	movement.BalanceAfter = uint(balance)
+	return tx.Create(&movement).Error
+}
+
+func sumStockMovements(db *gorm.DB, productID uint) (int64, error) {
+	var sum int64
+	err := db.Model(&model.StockMovement{}).
+		Select("COALESCE(SUM(change), 0)").
+		Where("product_id = ?", productID).
+		Scan(&sum).Error
+	return sum, err
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"reflect"
+	"testing"
+
+	"shop.go/model"
+)
+
+func TestSumItemQuantities(t *testing.T) {
+	items := []model.OrderItem{
+		{ID: 1, ProductID: 20, Quantity: 2},
+		{ID: 2, ProductID: 10, Quantity: 1},
+		{ID: 3, ProductID: 20, Quantity: 3},
+	}
+
+	quantities, productIDs := sumItemQuantities(items)
+
+	wantQuantities := map[uint]uint{10: 1, 20: 5}
+	if !reflect.DeepEqual(quantities, wantQuantities) {
+		t.Errorf("quantities = %v, want %v", quantities, wantQuantities)
+	}
+	wantIDs := []uint{20, 10}
+	if !reflect.DeepEqual(productIDs, wantIDs) {
+		t.Errorf("productIDs = %v, want %v", productIDs, wantIDs)
+	}
+}
+
+func TestSellableQuantity(t *testing.T) {
+	tests := []struct {
+		name     string
+		stock    uint
+		inactive uint
+		want     uint
+	}{
+		{name: "沒有停用倉庫", stock: 10, inactive: 0, want: 10},
+		{name: "扣掉停用倉庫", stock: 10, inactive: 4, want: 6},
+		{name: "全部在停用倉庫", stock: 4, inactive: 4, want: 0},
+		{name: "停用倉庫比總庫存多", stock: 3, inactive: 5, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sellableQuantity(tt.stock, tt.inactive); got != tt.want {
+				t.Errorf("sellableQuantity(%v, %v) = %v, want %v", tt.stock, tt.inactive, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStockLevelsRecord(t *testing.T) {
+	levels := stockLevels{}
+	// 分倉出貨同一商品有多筆異動：6 => 4 => 3
+	levels.record(10, 6, 4)
+	levels.record(10, 4, 3)
+	levels.record(11, 8, 7)
+
+	want := stockLevels{10: {Before: 6, After: 3}, 11: {Before: 8, After: 7}}
+	if !reflect.DeepEqual(levels, want) {
+		t.Errorf("levels = %v, want %v", levels, want)
+	}
+
+	var none stockLevels
+	none.record(10, 6, 4)
+	if none != nil {
+		t.Errorf("nil levels recorded %v", none)
+	}
+}
+
+func TestStockLevelCrossedBelow(t *testing.T) {
+	tests := []struct {
+		name  string
+		level *stockLevel
+		want  bool
+	}{
+		{name: "跌破門檻", level: &stockLevel{Before: 6, After: 3}, want: true},
+		{name: "剛好等於門檻", level: &stockLevel{Before: 6, After: 5}, want: true},
+		{name: "原本就低於門檻", level: &stockLevel{Before: 4, After: 3}, want: false},
+		{name: "還在門檻之上", level: &stockLevel{Before: 10, After: 6}, want: false},
+		{name: "補貨回到門檻之上", level: &stockLevel{Before: 3, After: 8}, want: false},
+		{name: "沒有異動", level: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.level.crossedBelow(5); got != tt.want {
+				t.Errorf("crossedBelow(5) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
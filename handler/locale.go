@@ -0,0 +1,348 @@
+package handler
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type UpdateTranslationRequest struct {
+	Name        string `binding:"required"`
+	Description string
+}
+
+// 預設語系，商品與種類本身的 Name、Description 就是這個語系
+func defaultLocale() string {
+	locale := os.Getenv("DEFAULT_LOCALE")
+	if locale == "" {
+		return "zh-TW"
+	}
+
+	return locale
+}
+
+// 支援的語系，由 SUPPORTED_LOCALES 設定（逗號分隔），一定包含預設語系
+func supportedLocales() []string {
+	locales := []string{defaultLocale()}
+	env := os.Getenv("SUPPORTED_LOCALES")
+	if env == "" {
+		env = "zh-TW,en"
+	}
+	for _, locale := range strings.Split(env, ",") {
+		locale = strings.TrimSpace(locale)
+		if locale != "" && !strings.EqualFold(locale, defaultLocale()) {
+			locales = append(locales, locale)
+		}
+	}
+
+	return locales
+}
+
+// 對應到支援的語系，先完全比對，再比對主要語言（en-US → en、zh → zh-TW）
+func matchLocale(tag string) (string, bool) {
+	tag = strings.TrimSpace(strings.ReplaceAll(tag, "_", "-"))
+	if tag == "" {
+		return "", false
+	}
+
+	locales := supportedLocales()
+	for _, locale := range locales {
+		if strings.EqualFold(locale, tag) {
+			return locale, true
+		}
+	}
+
+	primary := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+	for _, locale := range locales {
+		if strings.ToLower(strings.SplitN(locale, "-", 2)[0]) == primary {
+			return locale, true
+		}
+	}
+
+	return "", false
+}
+
+// 從 query lang 或 Accept-Language 決定語系，都沒有對應時用預設語系
+func resolveLocale(ctx *gin.Context) string {
+	if locale, ok := matchLocale(ctx.Query("lang")); ok {
+		return locale
+	}
+
+	// Accept-Language 依 q 值由高到低比對
+	type candidate struct {
+		tag string
+		q   float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(ctx.GetHeader("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		c := candidate{tag: strings.TrimSpace(fields[0]), q: 1}
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				if err == nil {
+					c.q = q
+				}
+			}
+		}
+		if c.tag != "" && c.tag != "*" && c.q > 0 {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].q > candidates[j].q
+	})
+
+	for _, c := range candidates {
+		if locale, ok := matchLocale(c.tag); ok {
+			return locale
+		}
+	}
+
+	return defaultLocale()
+}
+
+// 把商品（含種類、組合商品組成）的文字換成指定語系，沒有翻譯的沿用預設語系
+func localizeProducts(products []model.Product, locale string) error {
+	for i := range products {
+		products[i].Locale = locale
+		products[i].Category.Locale = locale
+		for j := range products[i].BundleComponents {
+			products[i].BundleComponents[j].Component.Locale = locale
+		}
+	}
+	if locale == defaultLocale() || len(products) == 0 {
+		return nil
+	}
+
+	var productIDs []uint
+	var categoryIDs []uint
+	for _, p := range products {
+		productIDs = append(productIDs, p.ID)
+		categoryIDs = append(categoryIDs, p.CategoryID)
+		for _, c := range p.BundleComponents {
+			productIDs = append(productIDs, c.ComponentID)
+		}
+	}
+
+	var productTranslations []model.ProductTranslation
+	err := boot.DB.Where("product_id IN ? AND locale = ?", productIDs, locale).Find(&productTranslations).Error
+	if err != nil {
+		return err
+	}
+	translations := map[uint]model.ProductTranslation{}
+	for _, t := range productTranslations {
+		translations[t.ProductID] = t
+	}
+
+	var categoryTranslations []model.CategoryTranslation
+	err = boot.DB.Where("category_id IN ? AND locale = ?", categoryIDs, locale).Find(&categoryTranslations).Error
+	if err != nil {
+		return err
+	}
+	categories := map[uint]model.CategoryTranslation{}
+	for _, t := range categoryTranslations {
+		categories[t.CategoryID] = t
+	}
+
+	for i := range products {
+		if t, ok := translations[products[i].ID]; ok {
+			products[i].Name = t.Name
+			products[i].Description = t.Description
+		}
+		if t, ok := categories[products[i].Category.ID]; ok {
+			products[i].Category.Name = t.Name
+			products[i].Category.Description = t.Description
+		}
+		for j := range products[i].BundleComponents {
+			component := &products[i].BundleComponents[j].Component
+			if t, ok := translations[component.ID]; ok {
+				component.Name = t.Name
+				component.Description = t.Description
+			}
+		}
+	}
+
+	return nil
+}
+
+// 把種類的文字換成指定語系，沒有翻譯的沿用預設語系
+func localizeCategories(categories []model.Category, locale string) error {
+	for i := range categories {
+		categories[i].Locale = locale
+	}
+	if locale == defaultLocale() || len(categories) == 0 {
+		return nil
+	}
+
+	var categoryIDs []uint
+	for _, c := range categories {
+		categoryIDs = append(categoryIDs, c.ID)
+	}
+
+	var rows []model.CategoryTranslation
+	err := boot.DB.Where("category_id IN ? AND locale = ?", categoryIDs, locale).Find(&rows).Error
+	if err != nil {
+		return err
+	}
+	translations := map[uint]model.CategoryTranslation{}
+	for _, t := range rows {
+		translations[t.CategoryID] = t
+	}
+
+	for i := range categories {
+		if t, ok := translations[categories[i].ID]; ok {
+			categories[i].Name = t.Name
+			categories[i].Description = t.Description
+		}
+	}
+
+	return nil
+}
+
+// 後台翻譯的語系只能是支援的非預設語系
+func translationLocale(ctx *gin.Context) (string, bool) {
+	locale, ok := matchLocale(ctx.Param("locale"))
+	if !ok || !strings.EqualFold(locale, ctx.Param("locale")) || locale == defaultLocale() {
+		ctx.JSON(http.StatusBadRequest, "locale is not supported")
+		return "", false
+	}
+
+	return locale, true
+}
+
+func ListProductTranslations(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	translations := []model.ProductTranslation{}
+	err := boot.DB.Where("product_id = ?", productId).Order("locale ASC").Find(&translations).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, translations)
+}
+
+// 新增或更新商品某語系的翻譯
+func UpdateProductTranslation(ctx *gin.Context) {
+	locale, ok := translationLocale(ctx)
+	if !ok {
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := UpdateTranslationRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	translation := model.ProductTranslation{
+		ProductID:   product.ID,
+		Locale:      locale,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	err = boot.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(&translation).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+func DeleteProductTranslation(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	err := boot.DB.Where("product_id = ? AND locale = ?", productId, ctx.Param("locale")).
+		Delete(&model.ProductTranslation{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+func ListCategoryTranslations(ctx *gin.Context) {
+	categoryId := ctx.Param("categoryId")
+	translations := []model.CategoryTranslation{}
+	err := boot.DB.Where("category_id = ?", categoryId).Order("locale ASC").Find(&translations).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, translations)
+}
+
+// 新增或更新種類某語系的翻譯
+func UpdateCategoryTranslation(ctx *gin.Context) {
+	locale, ok := translationLocale(ctx)
+	if !ok {
+		return
+	}
+
+	categoryId := ctx.Param("categoryId")
+	category := model.Category{}
+	err := boot.DB.First(&category, categoryId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := UpdateTranslationRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	translation := model.CategoryTranslation{
+		CategoryID:  category.ID,
+		Locale:      locale,
+		Name:        req.Name,
+		Description: req.Description,
+	}
+	err = boot.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "category_id"}, {Name: "locale"}},
+		DoUpdates: clause.AssignmentColumns([]string{"name", "description", "updated_at"}),
+	}).Create(&translation).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+func DeleteCategoryTranslation(ctx *gin.Context) {
+	categoryId := ctx.Param("categoryId")
+	err := boot.DB.Where("category_id = ? AND locale = ?", categoryId, ctx.Param("locale")).
+		Delete(&model.CategoryTranslation{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
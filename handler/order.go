@@ -1,42 +1,64 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"shop.go/boot"
 	"shop.go/enum"
 	"shop.go/model"
 )
 
 type CreateOrderRequest struct {
-	RecipientName    string  `binding:"required"`
-	RecipientPhone   string  `binding:"required"`
-	RecipientEmail   string  `binding:"required"`
-	RecipientAddress string  `binding:"required"`
-	TotalAmount      float64 `binding:"required"`
-	PaymentMethod    string  `binding:"required"`
+	RecipientName    string   `binding:"required"`
+	RecipientPhone   string   `binding:"required"`
+	RecipientEmail   string   `binding:"required"`
+	RecipientAddress string   // 只有數位商品時可以不填
+	TotalAmount      *float64 `binding:"required"` // 結帳預覽的 GrandTotal，和伺服器計算不同時拒絕
+	ChargedAmount    *float64 // 結帳預覽的 ChargedAmount，付款幣別不是基準幣時必填，匯率變動時拒絕
+	CouponCode       string
+	PaymentMethod    string   `binding:"required"`
+	Currency         string   // 付款幣別，沒填用 query currency 或 X-Currency header
+	Latitude         *float64 // 收件地點，用於就近出貨
+	Longitude        *float64
 }
 
 type ListOrdersQuery struct {
-	CurrentPage int `form:"currentPage" binding:"required"`
-	PerPage     int `form:"perPage" binding:"required"`
+	PageQuery
 }
 
 type ListOrdersResponse struct {
 	Message string
 	List    []model.Order
-	Total   int64
+	PageInfo
 }
 
 type UpdateOrderRequest struct {
-	Status string `binding:"required"`
+	Status string `binding:"required,oneof=pending paid processing shipped delivered canceled"`
 }
 
-func CreateOrder(ctx *gin.Context) {
-	tx := boot.DB.Begin()
+var errEmptyCart = errors.New("購物車是空的")
+var errAddressRequired = errors.New("有實體商品，請填寫收件地址")
+var errProductUnavailable = errors.New("購物車有已下架的商品")
+var errPriceChanged = errors.New("商品價格已變動，請重新確認購物車")
+var errChargedAmountRequired = errors.New("非基準幣付款請填寫結帳預覽的 ChargedAmount")
+var errOrderCanceled = errors.New("訂單已取消")
+
+// 新訂單在前
+var orderPageOrder = pageOrder[model.Order]{
+	Name: "order_newest",
+	Keys: []pageKey[model.Order]{
+		{Column: `"order".created_at`, Desc: true, Value: func(o model.Order) any { return o.CreatedAt }},
+		{Column: `"order".id`, Desc: true, Value: func(o model.Order) any { return o.ID }},
+	},
+}
 
+func CreateOrder(ctx *gin.Context) {
 	// 建立訂單
 	userID, exists := ctx.Get("user_id")
 	if !exists {
@@ -57,65 +79,150 @@ func CreateOrder(ctx *gin.Context) {
 		return
 	}
 
-	order := model.Order{
-		UserID:           uint(newVal),
-		RecipientName:    req.RecipientName,
-		RecipientPhone:   req.RecipientPhone,
-		RecipientEmail:   req.RecipientEmail,
-		RecipientAddress: req.RecipientAddress,
-		TotalAmount:      req.TotalAmount,
-		PaymentMethod:    req.PaymentMethod,
-		Status:           enum.OrderStatusPending,
-	}
-	err = tx.Create(&order).Error
+	// 付款幣別，匯率在下單當下鎖定
+	rate, err := lookupCurrency(checkoutCurrency(ctx, req.Currency))
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// 拿購物車
-	var cartItems []model.CartItem
-	err = tx.Where("user_id = ?", userID).Find(&cartItems).Error
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+	if rate.Currency != baseCurrency() && req.ChargedAmount == nil {
+		ctx.JSON(http.StatusBadRequest, errChargedAmountRequired.Error())
 		return
 	}
 
-	// 用購物車建立訂單細項
-	var orderItems []model.OrderItem
-	for _, cartItem := range cartItems {
-		orderItem := model.OrderItem{
-			OrderID:   order.ID,
-			ProductID: cartItem.ProductID,
-			Quantity:  cartItem.Quantity,
-			UnitPrice: cartItem.UnitPrice,
+	var location *shippingLocation
+	if req.Latitude != nil && req.Longitude != nil {
+		location = &shippingLocation{Latitude: *req.Latitude, Longitude: *req.Longitude}
+	}
+
+	var productIDs []uint
+	levels := stockLevels{}
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		// 和結帳預覽用同樣的方式計算金額
+		breakdown, cartItems, err := calculateCheckout(tx, uint(newVal), req.RecipientAddress, req.CouponCode, rate)
+		if err != nil {
+			return err
+		}
+		if math.Abs(*req.TotalAmount-breakdown.GrandTotal) >= 0.01 {
+			return errPriceChanged
+		}
+		// 實際收取的是付款幣別金額，匯率變動也要重新確認
+		if req.ChargedAmount != nil && math.Abs(*req.ChargedAmount-breakdown.ChargedAmount) >= 0.01 {
+			return errPriceChanged
+		}
+
+		// 優惠券用量，條件更新避免超用
+		if breakdown.coupon != nil {
+			result := tx.Model(&model.Coupon{}).
+				Where("id = ? AND (usage_limit IS NULL OR used_count < usage_limit)", breakdown.coupon.ID).
+				UpdateColumn("used_count", gorm.Expr("used_count + 1"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return &CouponError{Reason: "優惠券已用完"}
+			}
+		}
+
+		order := model.Order{
+			UserID:           uint(newVal),
+			RecipientName:    req.RecipientName,
+			RecipientPhone:   req.RecipientPhone,
+			RecipientEmail:   req.RecipientEmail,
+			RecipientAddress: req.RecipientAddress,
+			Subtotal:         breakdown.Subtotal,
+			CouponCode:       breakdown.CouponCode,
+			DiscountAmount:   breakdown.Discount,
+			ShippingFee:      breakdown.Shipping,
+			TaxAmount:        breakdown.Tax,
+			TotalAmount:      breakdown.GrandTotal,
+			Currency:         breakdown.Currency,
+			ExchangeRate:     breakdown.ExchangeRate,
+			ChargedAmount:    breakdown.ChargedAmount,
+			PaymentMethod:    req.PaymentMethod,
+			Status:           enum.OrderStatusPending,
+		}
+		err = tx.Create(&order).Error
+		if err != nil {
+			return err
+		}
+
+		// 用購物車建立訂單細項
+		var orderItems []model.OrderItem
+		for _, cartItem := range cartItems {
+			orderItem := model.OrderItem{
+				OrderID:   order.ID,
+				ProductID: cartItem.ProductID,
+				Quantity:  cartItem.Quantity,
+				UnitPrice: cartItem.UnitPrice,
+			}
+			orderItems = append(orderItems, orderItem)
+			productIDs = append(productIDs, cartItem.ProductID)
+		}
+		err = tx.Create(&orderItems).Error
+		if err != nil {
+			return err
 		}
-		orderItems = append(orderItems, orderItem)
+
+		// 扣庫存
+		err = reserveStock(tx, levels, order.ID, orderItems, location)
+		if err != nil {
+			return err
+		}
+
+		// 購物車提醒挽回
+		err = markCartRecovered(tx, order.UserID, order.ID)
+		if err != nil {
+			return err
+		}
+
+		// 清空購物車
+		return tx.Where("user_id = ?", userID).Delete(&model.CartItem{}).Error
+	})
+
+	var outOfStock *OutOfStockError
+	if errors.As(err, &outOfStock) {
+		ctx.JSON(http.StatusConflict, OutOfStockResponse{
+			Message: outOfStock.Error(),
+			Items:   outOfStock.Items,
+		})
+		return
 	}
-	err = tx.Create(&orderItems).Error
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+	var quantityErr *CartQuantityError
+	if errors.As(err, &quantityErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	var couponErr *CouponError
+	if errors.As(err, &couponErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, errPriceChanged) {
+		ctx.JSON(http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, errEmptyCart) || errors.Is(err, errAddressRequired) || errors.Is(err, errProductUnavailable) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
-
-	// 清空購物車
-	err = tx.Where("user_id = ?", userID).Delete(&model.CartItem{}).Error
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	tx.Commit()
+	go notifyStockChange(productIDs, levels)
 
 	ctx.JSON(http.StatusOK, "建立訂單成功")
 }
 
+// 擁有者檢查由 middleware.Owner 處理
 func GetOrder(ctx *gin.Context) {
 	orderId := ctx.Param("orderId")
 	order := model.Order{}
 	err := boot.DB.Preload("OrderItems.Product").First(&order, orderId).Error
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+		ctx.JSON(http.StatusNotFound, err.Error())
 		return
 	}
 
@@ -124,8 +231,6 @@ func GetOrder(ctx *gin.Context) {
 
 // 只能查詢自己訂單
 func ListOrdersByCustomer(ctx *gin.Context) {
-	var orders []model.Order
-	var total int64
 	var query ListOrdersQuery
 	userID, exists := ctx.Get("user_id")
 	if !exists {
@@ -147,33 +252,26 @@ func ListOrdersByCustomer(ctx *gin.Context) {
 		db = db.Where("user_id = ?", userID)
 	}
 
-	// 計算總數
-	db.Count(&total)
-
-	// 加入排序
-	db = db.Order("created_at DESC")
-
-	// 只有當 CurrentPage 和 PerPage 都是 -1 時才返回全部，否則必須分頁
-	if query.CurrentPage == -1 && query.PerPage == -1 {
-		// 返回全部資料
-		db.Find(&orders)
-	} else {
-		// 分頁查詢
-		offset := (query.CurrentPage - 1) * query.PerPage
-		db.Offset(offset).Limit(query.PerPage).Find(&orders)
+	// 分頁查詢
+	orders, page, err := paginate(db, query.PageQuery, orderPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, ListOrdersResponse{
-		Message: "success",
-		List:    orders,
-		Total:   total,
+		Message:  "success",
+		List:     orders,
+		PageInfo: page,
 	})
 }
 
 // 能查詢所有人訂單
 func ListOrdersByAdmin(ctx *gin.Context) {
-	var orders []model.Order
-	var total int64
 	var query ListOrdersQuery
 
 	// 自動綁定和驗證
@@ -185,48 +283,82 @@ func ListOrdersByAdmin(ctx *gin.Context) {
 	// 建立查詢
 	db := boot.DB.Model(&model.Order{}).Preload("OrderItems")
 
-	// 計算總數
-	db.Count(&total)
-
-	// 加入排序
-	db = db.Order("created_at DESC")
-
-	// 只有當 CurrentPage 和 PerPage 都是 -1 時才返回全部，否則必須分頁
-	if query.CurrentPage == -1 && query.PerPage == -1 {
-		// 返回全部資料
-		db.Find(&orders)
-	} else {
-		// 分頁查詢
-		offset := (query.CurrentPage - 1) * query.PerPage
-		db.Offset(offset).Limit(query.PerPage).Find(&orders)
+	// 分頁查詢
+	orders, page, err := paginate(db, query.PageQuery, orderPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, ListOrdersResponse{
-		List:  orders,
-		Total: total,
+		List:     orders,
+		PageInfo: page,
 	})
 }
 
 func UpdateOrder(ctx *gin.Context) {
-	// 找商品
 	orderId := ctx.Param("orderId")
-	order := model.Order{}
-	err := boot.DB.First(&order, orderId).Error
+	req := UpdateOrderRequest{}
+	err := ctx.ShouldBind(&req)
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, err.Error())
+		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
 
-	req := UpdateOrderRequest{}
-	err = ctx.ShouldBind(&req)
-	if err != nil {
+	// 鎖定訂單後再判斷狀態，避免同時取消重複歸還庫存
+	status := enum.OrderStatus(req.Status)
+	order := model.Order{}
+	restocked := false
+	levels := stockLevels{}
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("OrderItems.Allocations").
+			First(&order, orderId).Error
+		if err != nil {
+			return err
+		}
+
+		// 已取消的訂單庫存已歸還，不能再改狀態
+		if order.Status == enum.OrderStatusCanceled && status != enum.OrderStatusCanceled {
+			return errOrderCanceled
+		}
+
+		// 取消訂單時歸還庫存
+		restocked = status == enum.OrderStatusCanceled && order.Status != enum.OrderStatusCanceled
+		if restocked {
+			err := restoreStock(tx, levels, order.ID, order.OrderItems)
+			if err != nil {
+				return err
+			}
+		}
+
+		order.Status = status
+		return tx.Omit("OrderItems").Save(&order).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, errOrderCanceled) {
 		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
 	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	order.Status = enum.OrderStatus(req.Status)
-
-	boot.DB.Save(&order)
+	if restocked {
+		var productIDs []uint
+		for _, item := range order.OrderItems {
+			productIDs = append(productIDs, item.ProductID)
+		}
+		go notifyStockChange(productIDs, levels)
+	}
 
 	ctx.JSON(http.StatusOK, "更新成功")
 }
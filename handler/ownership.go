@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"shop.go/boot"
+	"shop.go/middleware"
+	"shop.go/model"
+)
+
+// 給 middleware.Owner 用的擁有者查詢
+
+func CartItemOwner(id string) (middleware.ResourceOwner, error) {
+	item := model.CartItem{}
+	err := boot.DB.Select("id", "user_id", "guest_cart_id").First(&item, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: item.UserID, GuestCartID: item.GuestCartID}, nil
+}
+
+func SavedItemOwner(id string) (middleware.ResourceOwner, error) {
+	item := model.SavedItem{}
+	err := boot.DB.Select("id", "user_id").First(&item, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: &item.UserID}, nil
+}
+
+func OrderOwner(id string) (middleware.ResourceOwner, error) {
+	order := model.Order{}
+	err := boot.DB.Select("id", "user_id").First(&order, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: &order.UserID}, nil
+}
+
+func CommentOwner(id string) (middleware.ResourceOwner, error) {
+	comment := model.Comment{}
+	err := boot.DB.Select("id", "user_id").First(&comment, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: &comment.UserID}, nil
+}
+
+func QuestionOwner(id string) (middleware.ResourceOwner, error) {
+	question := model.ProductQuestion{}
+	err := boot.DB.Select("id", "user_id").First(&question, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: &question.UserID}, nil
+}
+
+func AnswerOwner(id string) (middleware.ResourceOwner, error) {
+	answer := model.ProductAnswer{}
+	err := boot.DB.Select("id", "user_id").First(&answer, id).Error
+	if err != nil {
+		return middleware.ResourceOwner{}, err
+	}
+
+	return middleware.ResourceOwner{UserID: &answer.UserID}, nil
+}
@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const defaultPageSize = 20
+const maxPageSize = 100
+
+// 所有列表共用的分頁參數，cursor 用上一頁回傳的 NextCursor
+type PageQuery struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// 所有列表共用的分頁資訊
+type PageInfo struct {
+	Total      int64
+	Limit      int
+	NextCursor string // 空字串代表沒有下一頁
+	HasMore    bool
+}
+
+// 排序欄位，Column 帶資料表名稱避免 JOIN 時欄位不明確
+type pageKey[T any] struct {
+	Column string
+	Desc   bool
+	Value  func(T) any
+}
+
+// 排序方式，最後一個欄位必須唯一（通常是 id）確保順序穩定
+type pageOrder[T any] struct {
+	Name string
+	Keys []pageKey[T]
+}
+
+// cursor 內容，對用戶端不透明
+type cursorData struct {
+	Order  string
+	Values []json.RawMessage
+}
+
+var errInvalidCursor = errors.New("cursor is not valid")
+
+// keyset 分頁：依 order 排序，從 cursor 的下一筆開始取 limit 筆
+func paginate[T any](db *gorm.DB, query PageQuery, order pageOrder[T]) ([]T, PageInfo, error) {
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	info := PageInfo{Limit: limit}
+
+	// 計算總數
+	err := db.Session(&gorm.Session{}).Count(&info.Total).Error
+	if err != nil {
+		return nil, info, err
+	}
+
+	// 從 cursor 之後開始
+	if query.Cursor != "" {
+		values, err := decodeCursor(query.Cursor, order)
+		if err != nil {
+			return nil, info, err
+		}
+		sql, args := keysetCondition(order, values)
+		db = db.Where(sql, args...)
+	}
+
+	// 加入排序
+	for _, key := range order.Keys {
+		direction := " ASC"
+		if key.Desc {
+			direction = " DESC"
+		}
+		db = db.Order(key.Column + direction)
+	}
+
+	// 多拿一筆判斷是否有下一頁
+	list := []T{}
+	err = db.Limit(limit + 1).Find(&list).Error
+	if err != nil {
+		return nil, info, err
+	}
+
+	if len(list) > limit {
+		list = list[:limit]
+		info.HasMore = true
+		info.NextCursor, err = encodeCursor(list[len(list)-1], order)
+		if err != nil {
+			return nil, info, err
+		}
+	}
+
+	return list, info, nil
+}
+
+// (a, b, id) 之後的資料：a 超過，或 a 相同且 b 超過，依此類推
+func keysetCondition[T any](order pageOrder[T], values []any) (string, []any) {
+	var clauses []string
+	var args []any
+	for i, key := range order.Keys {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, order.Keys[j].Column+" = ?")
+			args = append(args, values[j])
+		}
+
+		operator := " > ?"
+		if key.Desc {
+			operator = " < ?"
+		}
+		parts = append(parts, key.Column+operator)
+		args = append(args, values[i])
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func encodeCursor[T any](item T, order pageOrder[T]) (string, error) {
+	data := cursorData{Order: order.Name}
+	for _, key := range order.Keys {
+		value, err := json.Marshal(key.Value(item))
+		if err != nil {
+			return "", err
+		}
+		data.Values = append(data.Values, value)
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// 還原 cursor，值依排序欄位的型別解析
+func decodeCursor[T any](cursor string, order pageOrder[T]) ([]any, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	data := cursorData{}
+	err = json.Unmarshal(b, &data)
+	if err != nil || data.Order != order.Name || len(data.Values) != len(order.Keys) {
+		return nil, errInvalidCursor
+	}
+
+	var zero T
+	values := []any{}
+	for i, key := range order.Keys {
+		value := reflect.New(reflect.TypeOf(key.Value(zero)))
+		err := json.Unmarshal(data.Values[i], value.Interface())
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		values = append(values, value.Elem().Interface())
+	}
+
+	return values, nil
+}
@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type UpdateProductSaleRequest struct {
+	SalePrice float64    `binding:"required,gt=0"`
+	StartAt   *time.Time // 沒填立即開始
+	EndAt     *time.Time // 沒填不會結束
+}
+
+// 設定商品特價，直接生效不需發佈
+func UpdateProductSale(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := UpdateProductSaleRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.SalePrice >= product.Price {
+		ctx.JSON(http.StatusBadRequest, "特價必須低於原價")
+		return
+	}
+	if req.StartAt != nil && req.EndAt != nil && !req.EndAt.After(*req.StartAt) {
+		ctx.JSON(http.StatusBadRequest, "結束時間必須晚於開始時間")
+		return
+	}
+
+	product.SalePrice = &req.SalePrice
+	product.SaleStartAt = req.StartAt
+	product.SaleEndAt = req.EndAt
+	err = boot.DB.Model(&product).Select("sale_price", "sale_start_at", "sale_end_at").Updates(&product).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 取消特價
+func DeleteProductSale(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	err := boot.DB.Model(&model.Product{}).
+		Where("id = ?", productId).
+		Updates(map[string]any{"sale_price": nil, "sale_start_at": nil, "sale_end_at": nil}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 商品目前售價，特價期間用特價
+func effectivePrice(product model.Product) float64 {
+	now := time.Now()
+	if product.SalePrice == nil {
+		return product.Price
+	}
+	if product.SaleStartAt != nil && now.Before(*product.SaleStartAt) {
+		return product.Price
+	}
+	if product.SaleEndAt != nil && !now.Before(*product.SaleEndAt) {
+		return product.Price
+	}
+
+	return *product.SalePrice
+}
+
+// 購物車依商品目前售價重新計價，需先 Preload Product
+func repriceCartItems(db *gorm.DB, items []model.CartItem) error {
+	for i := range items {
+		item := &items[i]
+		price := effectivePrice(item.Product)
+
+		// 舊資料沒有加入時的售價
+		if item.PriceAtAdd == 0 {
+			item.PriceAtAdd = item.UnitPrice
+		}
+
+		if item.UnitPrice != price {
+			item.UnitPrice = price
+			// 不更新 updated_at，閒置購物車偵測以它為準
+			err := db.Model(&model.CartItem{}).
+				Where("id = ?", item.ID).
+				UpdateColumns(map[string]any{"unit_price": item.UnitPrice, "price_at_add": item.PriceAtAdd}).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		item.PriceChanged = item.UnitPrice != item.PriceAtAdd
+	}
+
+	return nil
+}
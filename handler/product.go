@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -8,34 +9,51 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 	"shop.go/boot"
+	"shop.go/enum"
 	"shop.go/model"
 )
 
 type AddProductRequest struct {
-	Name          string  `form:"Name" binding:"required"`
-	CategoryID    uint    `form:"CategoryID" binding:"required"`
-	Price         float64 `form:"Price" binding:"required"`
-	StockQuantity uint    `form:"StockQuantity" binding:"required"`
-	Description   string  `form:"Description" binding:"required"`
+	Name              string  `form:"Name" binding:"required"`
+	CategoryID        uint    `form:"CategoryID" binding:"required"`
+	Price             float64 `form:"Price" binding:"required"`
+	StockQuantity     uint    `form:"StockQuantity" binding:"required"`
+	LowStockThreshold *uint   `form:"LowStockThreshold"`
+	MaxPerOrder       *uint   `form:"MaxPerOrder" binding:"omitempty,min=1"`
+	Description       string  `form:"Description" binding:"required"`
+	Publish           bool    `form:"Publish"` // 新增時直接發佈，否則為草稿
 }
 
 type ListProductsQuery struct {
-	CurrentPage int    `form:"currentPage" binding:"required"`
-	PerPage     int    `form:"perPage" binding:"required"`
-	Name        string `form:"name"`
-	CategoryID  uint   `form:"categoryId"`
+	PageQuery
+	Name       string `form:"name"`
+	CategoryID uint   `form:"categoryId"`
+	Status     string `form:"status" binding:"omitempty,oneof=draft published"` // 管理員才能查草稿
 }
 
 type ListProductsResponse struct {
-	List  []model.Product
-	Total int64
+	List []model.Product
+	PageInfo
+}
+
+var productPageOrder = pageOrder[model.Product]{
+	Name: "product_id",
+	Keys: []pageKey[model.Product]{
+		{Column: "product.id", Value: func(p model.Product) any { return p.ID }},
+	},
 }
 
 func AddProduct(ctx *gin.Context) {
-	req := AddProductRequest{}
+	operatorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 
-	err := ctx.ShouldBind(&req)
+	req := AddProductRequest{}
+	err = ctx.ShouldBind(&req)
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, err.Error())
 		return
@@ -59,17 +77,42 @@ func AddProduct(ctx *gin.Context) {
 		return
 	}
 
-	// DB 存紀錄
+	// DB 存紀錄，初始庫存寫入流水帳
 	product := model.Product{
-		CategoryID:    req.CategoryID,
-		Name:          req.Name,
-		Description:   req.Description,
-		Price:         req.Price,
-		StockQuantity: req.StockQuantity,
-		ImageURL:      file.Filename,
+		CategoryID:        req.CategoryID,
+		Name:              req.Name,
+		Description:       req.Description,
+		Price:             req.Price,
+		StockQuantity:     req.StockQuantity,
+		LowStockThreshold: req.LowStockThreshold,
+		MaxPerOrder:       req.MaxPerOrder,
+		ImageURL:          file.Filename,
+		Status:            enum.ProductStatusDraft,
 	}
 
-	err = boot.DB.Create(&product).Error
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&product).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Create(&model.StockMovement{
+			ProductID:    product.ID,
+			Type:         enum.StockMovementInitial,
+			Change:       int(product.StockQuantity),
+			BalanceAfter: product.StockQuantity,
+			OperatorID:   &operatorID,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		if !req.Publish {
+			return nil
+		}
+
+		return saveProductRevision(tx, &product, &operatorID, "", true)
+	})
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err)
 		return
@@ -95,15 +138,50 @@ func UpdateProduct(ctx *gin.Context) {
 		return
 	}
 
-	product.Name = req.Name
-	product.CategoryID = req.CategoryID
-	product.Price = req.Price
-	product.StockQuantity = req.StockQuantity
-	product.Description = req.Description
+	operatorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
 
-	boot.DB.Save(&product)
+	stockBefore := product.StockQuantity
+	content := productContent{
+		CategoryID:        req.CategoryID,
+		Name:              req.Name,
+		Description:       req.Description,
+		Price:             req.Price,
+		LowStockThreshold: req.LowStockThreshold,
+		MaxPerOrder:       req.MaxPerOrder,
+	}
+
+	// 內容先存草稿，發佈後才上線；庫存異動直接生效，走流水帳
+	levels := stockLevels{}
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := saveProductDraft(tx, product.ID, content, &operatorID)
+		if err != nil {
+			return err
+		}
+
+		// 組合商品庫存由組成商品決定
+		if product.IsBundle {
+			return nil
+		}
+
+		return setStock(tx, levels, product.ID, req.StockQuantity, model.StockMovement{
+			Type:       enum.StockMovementAdminEdit,
+			OperatorID: &operatorID,
+		})
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
 
-	ctx.JSON(http.StatusOK, "更新成功")
+	if !product.IsBundle && req.StockQuantity != stockBefore {
+		go notifyStockChange([]uint{product.ID}, levels)
+	}
+
+	ctx.JSON(http.StatusOK, "已存成草稿")
 }
 
 func UpdateProductImage(ctx *gin.Context) {
@@ -146,8 +224,6 @@ func UpdateProductImage(ctx *gin.Context) {
 }
 
 func ListProducts(ctx *gin.Context) {
-	var products []model.Product
-	var total int64
 	var query ListProductsQuery
 
 	// 自動綁定和驗證
@@ -157,42 +233,125 @@ func ListProducts(ctx *gin.Context) {
 	}
 	log.Println("query.CategoryID: ", query.CategoryID)
 
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	// 建立查詢
 	db := boot.DB.Model(&model.Product{}).Preload("Category")
 
-	// 如果有搜尋名稱，加入模糊搜尋
-	if query.Name != "" {
+	// 如果有搜尋名稱，加入模糊搜尋，非預設語系也搜尋翻譯
+	locale := resolveLocale(ctx)
+	if query.Name != "" && locale != defaultLocale() {
+		db = db.Where("name LIKE ? OR id IN (?)", "%"+query.Name+"%",
+			boot.DB.Model(&model.ProductTranslation{}).
+				Select("product_id").
+				Where("locale = ? AND name LIKE ?", locale, "%"+query.Name+"%"))
+	} else if query.Name != "" {
 		db = db.Where("name LIKE ?", "%"+query.Name+"%")
 	}
 
+	// 前台只列出已發佈的商品
+	if !isAdmin(ctx) {
+		db = db.Where("status = ?", enum.ProductStatusPublished)
+	} else if query.Status != "" {
+		db = db.Where("status = ?", query.Status)
+	}
+
 	// 如果有分類，加入分類篩選
 	if query.CategoryID != 0 {
 		db = db.Where("category_id = ?", query.CategoryID)
 	}
 
-	// 計算總數
-	db.Count(&total)
+	// 分頁查詢
+	products, page, err := paginate(db, query.PageQuery, productPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 評分統計
+	err = fillProductRatings(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 可售數量
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 顯示幣別價格
+	fillProductPrices(products, rate)
 
-	// 只有當 CurrentPage 和 PerPage 都是 -1 時才返回全部，否則必須分頁
-	if query.CurrentPage == -1 && query.PerPage == -1 {
-		// 返回全部資料
-		db.Find(&products)
-	} else {
-		// 分頁查詢
-		offset := (query.CurrentPage - 1) * query.PerPage
-		db.Offset(offset).Limit(query.PerPage).Find(&products)
+	// 語系
+	err = localizeProducts(products, locale)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, ListProductsResponse{
-		List:  products,
-		Total: total,
+		List:     products,
+		PageInfo: page,
 	})
 }
 
 func GetProduct(ctx *gin.Context) {
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
 	productId := ctx.Param("productId")
 	product := model.Product{}
-	err := boot.DB.First(&product, productId).Error
+	err = boot.DB.Preload("BundleComponents.Component").First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !isProductVisible(ctx, product) {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 可售數量
+	products := []model.Product{product}
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	fillProductPrices(products, rate)
+
+	// 語系
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	product = products[0]
+
+	// 評分統計
+	ratings, err := getProductRatings([]uint{product.ID})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	product.Rating = ratings[product.ID]
+
+	// 熱門問答
+	product.TopQuestions, err = getTopQuestions(product.ID)
 	if err != nil {
 		ctx.JSON(http.StatusInternalServerError, err.Error())
 		return
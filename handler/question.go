@@ -0,0 +1,353 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddQuestionRequest struct {
+	Content string `binding:"required"`
+}
+
+type AddAnswerRequest struct {
+	Content string `binding:"required"`
+}
+
+type ListQuestionsQuery struct {
+	PageQuery
+	Answered *bool `form:"answered"` // 只看已回答或未回答
+}
+
+type ListQuestionsResponse struct {
+	List []model.ProductQuestion
+	PageInfo
+}
+
+const topQuestionLimit = 3
+
+// 新問題在前
+var questionPageOrder = pageOrder[model.ProductQuestion]{
+	Name: "question_newest",
+	Keys: []pageKey[model.ProductQuestion]{
+		{Column: "product_question.created_at", Desc: true, Value: func(q model.ProductQuestion) any { return q.CreatedAt }},
+		{Column: "product_question.id", Desc: true, Value: func(q model.ProductQuestion) any { return q.ID }},
+	},
+}
+
+var errAlreadyVoted = errors.New("已經按過讚")
+
+// 回答依讚數排序，只帶出作者公開資訊
+func preloadAnswers(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Answers", func(db *gorm.DB) *gorm.DB {
+			return db.Order("votes DESC, created_at ASC")
+		}).
+		Preload("Answers.User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "avatar")
+		}).
+		Preload("User", func(db *gorm.DB) *gorm.DB {
+			return db.Select("id", "name", "avatar")
+		})
+}
+
+func ListProductQuestions(ctx *gin.Context) {
+	var query ListQuestionsQuery
+
+	// 自動綁定和驗證
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil || !isProductVisible(ctx, product) {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 建立查詢
+	db := preloadAnswers(boot.DB.Model(&model.ProductQuestion{})).
+		Where("product_id = ?", product.ID)
+
+	// 已回答篩選
+	if query.Answered != nil {
+		exists := "EXISTS (SELECT 1 FROM product_answer WHERE product_answer.question_id = product_question.id)"
+		if *query.Answered {
+			db = db.Where(exists)
+		} else {
+			db = db.Where("NOT " + exists)
+		}
+	}
+
+	// 分頁查詢
+	questions, page, err := paginate(db, query.PageQuery, questionPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListQuestionsResponse{
+		List:     questions,
+		PageInfo: page,
+	})
+}
+
+func AddProductQuestion(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := AddQuestionRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err = boot.DB.First(&product, productId).Error
+	if err != nil || product.Status != enum.ProductStatusPublished {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	question := model.ProductQuestion{
+		ProductID: product.ID,
+		UserID:    userID,
+		Content:   req.Content,
+	}
+	err = boot.DB.Create(&question).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, question)
+}
+
+// 提問者或管理員可以刪除問題
+func DeleteProductQuestion(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	questionId := ctx.Param("questionId")
+	db := boot.DB
+	if !isAdmin(ctx) {
+		db = db.Where("user_id = ?", userID)
+	}
+
+	question := model.ProductQuestion{}
+	err = db.First(&question, questionId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Delete(&question).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 管理員或買過且已收貨的會員才能回答
+func AddProductAnswer(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := AddAnswerRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	questionId := ctx.Param("questionId")
+	question := model.ProductQuestion{}
+	err = boot.DB.First(&question, questionId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	answer := model.ProductAnswer{
+		QuestionID: question.ID,
+		UserID:     userID,
+		Content:    req.Content,
+		IsAdmin:    isAdmin(ctx),
+	}
+	if !answer.IsAdmin {
+		purchased, err := hasDeliveredOrderItem(userID, question.ProductID)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !purchased {
+			ctx.JSON(http.StatusForbidden, "購買並收到商品後才能回答")
+			return
+		}
+		answer.IsVerifiedBuyer = true
+	}
+
+	err = boot.DB.Create(&answer).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, answer)
+}
+
+// 回答者或管理員可以刪除回答
+func DeleteProductAnswer(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	answerId := ctx.Param("answerId")
+	db := boot.DB
+	if !isAdmin(ctx) {
+		db = db.Where("user_id = ?", userID)
+	}
+
+	answer := model.ProductAnswer{}
+	err = db.First(&answer, answerId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Delete(&answer).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 回答按讚，每人一次，不能對自己的回答按讚
+func VoteProductAnswer(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	answerId := ctx.Param("answerId")
+	answer := model.ProductAnswer{}
+	err = boot.DB.First(&answer, answerId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if answer.UserID == userID {
+		ctx.JSON(http.StatusForbidden, "不能對自己的回答按讚")
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		err := tx.Model(&model.AnswerVote{}).
+			Where("answer_id = ? AND user_id = ?", answer.ID, userID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errAlreadyVoted
+		}
+
+		err = tx.Create(&model.AnswerVote{AnswerID: answer.ID, UserID: userID}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&answer).UpdateColumn("votes", gorm.Expr("votes + 1")).Error
+	})
+	if errors.Is(err, errAlreadyVoted) {
+		ctx.JSON(http.StatusConflict, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已按讚")
+}
+
+// 收回讚
+func UnvoteProductAnswer(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	answerId := ctx.Param("answerId")
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("answer_id = ? AND user_id = ?", answerId, userID).Delete(&model.AnswerVote{})
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		return tx.Model(&model.ProductAnswer{}).
+			Where("id = ? AND votes > 0", answerId).
+			UpdateColumn("votes", gorm.Expr("votes - 1")).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已收回")
+}
+
+// 已回答的問題依最高讚數排序，每題只帶最佳回答
+func getTopQuestions(productID uint) ([]model.ProductQuestion, error) {
+	var questions []model.ProductQuestion
+	err := preloadAnswers(boot.DB).
+		Where("product_id = ?", productID).
+		Where("EXISTS (SELECT 1 FROM product_answer WHERE product_answer.question_id = product_question.id)").
+		Order("(SELECT MAX(votes) FROM product_answer WHERE product_answer.question_id = product_question.id) DESC, id DESC").
+		Limit(topQuestionLimit).
+		Find(&questions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 只留最高票的回答，查詢期間回答可能被刪除
+	for i := range questions {
+		if len(questions[i].Answers) > 1 {
+			questions[i].Answers = questions[i].Answers[:1]
+		}
+	}
+
+	return questions, nil
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type ListRecommendationsQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=20"`
+}
+
+const defaultRecommendationLimit = 8
+
+// 常一起購買的商品，資料不足時補同種類熱銷商品
+func ListRelatedProducts(ctx *gin.Context) {
+	var query ListRecommendationsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if !isProductVisible(ctx, product) {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	products, err := recommendProducts([]uint{product.ID}, []uint{product.CategoryID}, query.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 顯示幣別價格
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	fillProductPrices(products, rate)
+
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, products)
+}
+
+// 依購物車內容推薦商品
+func ListCartRecommendations(ctx *gin.Context) {
+	var query ListRecommendationsQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var cartItems []model.CartItem
+	err = boot.DB.Preload("Product").Where("user_id = ?", userID).Find(&cartItems).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var productIDs, categoryIDs []uint
+	for _, item := range cartItems {
+		productIDs = append(productIDs, item.ProductID)
+		categoryIDs = append(categoryIDs, item.Product.CategoryID)
+	}
+
+	products, err := recommendProducts(productIDs, categoryIDs, query.Limit)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 顯示幣別價格
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	fillProductPrices(products, rate)
+
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, products)
+}
+
+// 先用共同購買統計，不夠再用種類熱銷補滿，排除來源商品與缺貨商品
+func recommendProducts(productIDs []uint, categoryIDs []uint, limit int) ([]model.Product, error) {
+	if limit == 0 {
+		limit = defaultRecommendationLimit
+	}
+
+	products := []model.Product{}
+	if len(productIDs) == 0 {
+		return products, nil
+	}
+
+	err := boot.DB.Model(&model.Product{}).
+		Select("product.*").
+		Joins("JOIN product_relation ON product_relation.related_product_id = product.id").
+		Where("product_relation.product_id IN ?", productIDs).
+		Where("product.id NOT IN ?", productIDs).
+		Where(inStockSQL+" AND product.status = ?", enum.ProductStatusPublished).
+		Group("product.id").
+		Order("SUM(product_relation.score) DESC, product.id DESC").
+		Limit(limit).
+		Find(&products).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(products) >= limit || len(categoryIDs) == 0 {
+		return products, fillStockAvailability(products)
+	}
+
+	// 資料不足，用同種類熱銷商品補
+	excludeIDs := append([]uint{}, productIDs...)
+	for _, p := range products {
+		excludeIDs = append(excludeIDs, p.ID)
+	}
+
+	var bestSellers []model.Product
+	err = boot.DB.Model(&model.Product{}).
+		Select("product.*").
+		Joins("LEFT JOIN order_item ON order_item.product_id = product.id").
+		Where("product.category_id IN ?", categoryIDs).
+		Where("product.id NOT IN ?", excludeIDs).
+		Where(inStockSQL+" AND product.status = ?", enum.ProductStatusPublished).
+		Group("product.id").
+		Order("COALESCE(SUM(order_item.quantity), 0) DESC, product.id DESC").
+		Limit(limit - len(products)).
+		Find(&bestSellers).Error
+	if err != nil {
+		return nil, err
+	}
+
+	products = append(products, bestSellers...)
+	return products, fillStockAvailability(products)
+}
+
+// 從訂單細項計算兩兩商品同時出現的訂單數，整批替換，由 job 定期呼叫
+func RefreshProductRelations() error {
+	return boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("1 = 1").Delete(&model.ProductRelation{}).Error
+		if err != nil {
+			return err
+		}
+
+		err = tx.Exec(`
+			INSERT INTO product_relation (product_id, related_product_id, score, created_at)
+			SELECT a.product_id, b.product_id, COUNT(DISTINCT a.order_id), NOW()
+			FROM order_item a
+			JOIN order_item b ON b.order_id = a.order_id AND b.product_id <> a.product_id
+			JOIN "order" ON "order".id = a.order_id
+			WHERE "order".status <> ?
+			GROUP BY a.product_id, b.product_id`,
+			enum.OrderStatusCanceled,
+		).Error
+		if err != nil {
+			return err
+		}
+
+		log.Println("Product relations refreshed successfully")
+
+		return nil
+	})
+}
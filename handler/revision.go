@@ -0,0 +1,515 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type PublishProductRequest struct {
+	PublishAt *time.Time // 有填且在未來就排程發佈
+}
+
+type ProductDraftResponse struct {
+	Product   model.Product // 套用草稿後的預覽
+	PublishAt *time.Time
+	EditorID  *uint
+	UpdatedAt time.Time
+	Changes   []RevisionChange
+}
+
+type ProductRevisionResponse struct {
+	ID        uint
+	Version   uint
+	Note      string
+	EditorID  *uint
+	CreatedAt time.Time
+	Content   productContent
+}
+
+type ListProductRevisionsResponse struct {
+	List []ProductRevisionResponse
+	PageInfo
+}
+
+type RevisionChange struct {
+	Field string
+	From  any
+	To    any
+}
+
+type RevisionDiffResponse struct {
+	FromVersion uint // 0 代表第一版之前
+	ToVersion   uint
+	Changes     []RevisionChange
+}
+
+// 需要發佈才會上線的商品內容，庫存、圖片不在這裡
+type productContent struct {
+	CategoryID        uint
+	Name              string
+	Description       string
+	Price             float64
+	LowStockThreshold *uint
+	MaxPerOrder       *uint
+}
+
+var errNothingToPublish = errors.New("沒有可以發佈的內容")
+
+// 新版本在前
+var revisionPageOrder = pageOrder[model.ProductRevision]{
+	Name: "revision_version_desc",
+	Keys: []pageKey[model.ProductRevision]{
+		{Column: "product_revision.version", Desc: true, Value: func(r model.ProductRevision) any { return r.Version }},
+	},
+}
+
+func contentOf(product model.Product) productContent {
+	return productContent{
+		CategoryID:        product.CategoryID,
+		Name:              product.Name,
+		Description:       product.Description,
+		Price:             product.Price,
+		LowStockThreshold: product.LowStockThreshold,
+		MaxPerOrder:       product.MaxPerOrder,
+	}
+}
+
+func (c productContent) applyTo(product *model.Product) {
+	product.CategoryID = c.CategoryID
+	product.Name = c.Name
+	product.Description = c.Description
+	product.Price = c.Price
+	product.LowStockThreshold = c.LowStockThreshold
+	product.MaxPerOrder = c.MaxPerOrder
+}
+
+// 逐欄比較兩份內容
+func diffContent(from, to productContent) []RevisionChange {
+	changes := []RevisionChange{}
+	a := reflect.ValueOf(from)
+	b := reflect.ValueOf(to)
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changes = append(changes, RevisionChange{
+				Field: a.Type().Field(i).Name,
+				From:  a.Field(i).Interface(),
+				To:    b.Field(i).Interface(),
+			})
+		}
+	}
+
+	return changes
+}
+
+func decodeContent(data string) (productContent, error) {
+	content := productContent{}
+	err := json.Unmarshal([]byte(data), &content)
+
+	return content, err
+}
+
+// 暫存商品編輯，發佈前前台看不到；內容變了就取消原本的排程，需重新排程
+func saveProductDraft(tx *gorm.DB, productID uint, content productContent, editorID *uint) error {
+	data, err := json.Marshal(content)
+	if err != nil {
+		return err
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"data", "editor_id", "publish_at", "updated_at"}),
+	}).Create(&model.ProductDraft{
+		ProductID: productID,
+		Data:      string(data),
+		EditorID:  editorID,
+	}).Error
+}
+
+// 套用草稿並上線，記錄新版本
+func publishProduct(tx *gorm.DB, productID uint, editorID *uint, note string) error {
+	product := model.Product{}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+	if err != nil {
+		return err
+	}
+
+	draft := model.ProductDraft{}
+	err = tx.Where("product_id = ?", productID).First(&draft).Error
+	hasDraft := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if !hasDraft && product.Status == enum.ProductStatusPublished {
+		return errNothingToPublish
+	}
+
+	if hasDraft {
+		content, err := decodeContent(draft.Data)
+		if err != nil {
+			return err
+		}
+		content.applyTo(&product)
+
+		err = tx.Delete(&draft).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return saveProductRevision(tx, &product, editorID, note, true)
+}
+
+// 把內容寫入商品並記錄版本，publish 為 true 時一併上線，否則維持原本狀態
+func saveProductRevision(tx *gorm.DB, product *model.Product, editorID *uint, note string, publish bool) error {
+	if publish {
+		now := time.Now()
+		product.Status = enum.ProductStatusPublished
+		product.PublishedAt = &now
+	}
+	err := tx.Model(product).
+		Select("category_id", "name", "description", "price", "low_stock_threshold", "max_per_order", "status", "published_at").
+		Updates(product).Error
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(contentOf(*product))
+	if err != nil {
+		return err
+	}
+
+	var version uint
+	err = tx.Model(&model.ProductRevision{}).
+		Where("product_id = ?", product.ID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&model.ProductRevision{
+		ProductID: product.ID,
+		Version:   version + 1,
+		Data:      string(data),
+		Note:      note,
+		EditorID:  editorID,
+	}).Error
+}
+
+// 預覽草稿
+func GetProductDraft(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.Preload("Category").First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	draft := model.ProductDraft{}
+	err = boot.DB.Where("product_id = ?", product.ID).First(&draft).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	content, err := decodeContent(draft.Data)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	changes := diffContent(contentOf(product), content)
+	content.applyTo(&product)
+	if product.Category.ID != product.CategoryID {
+		boot.DB.First(&product.Category, product.CategoryID)
+	}
+
+	ctx.JSON(http.StatusOK, ProductDraftResponse{
+		Product:   product,
+		PublishAt: draft.PublishAt,
+		EditorID:  draft.EditorID,
+		UpdatedAt: draft.UpdatedAt,
+		Changes:   changes,
+	})
+}
+
+// 捨棄草稿
+func DeleteProductDraft(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	err := boot.DB.Where("product_id = ?", productId).Delete(&model.ProductDraft{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 立即發佈，或填 PublishAt 排程發佈
+func PublishProduct(ctx *gin.Context) {
+	editorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := PublishProductRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err = boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 排程發佈
+	if req.PublishAt != nil && req.PublishAt.After(time.Now()) {
+		err = boot.DB.Transaction(func(tx *gorm.DB) error {
+			var count int64
+			err := tx.Model(&model.ProductDraft{}).Where("product_id = ?", product.ID).Count(&count).Error
+			if err != nil {
+				return err
+			}
+
+			// 草稿商品沒有暫存編輯時，排程發佈目前內容
+			if count == 0 {
+				if product.Status == enum.ProductStatusPublished {
+					return errNothingToPublish
+				}
+				err = saveProductDraft(tx, product.ID, contentOf(product), &editorID)
+				if err != nil {
+					return err
+				}
+			}
+
+			return tx.Model(&model.ProductDraft{}).
+				Where("product_id = ?", product.ID).
+				Update("publish_at", req.PublishAt).Error
+		})
+		if errors.Is(err, errNothingToPublish) {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		ctx.JSON(http.StatusOK, "已排程發佈")
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		return publishProduct(tx, product.ID, &editorID, "")
+	})
+	if errors.Is(err, errNothingToPublish) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已發佈")
+}
+
+// 下架成草稿，前台看不到
+func UnpublishProduct(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	result := boot.DB.Model(&model.Product{}).
+		Where("id = ?", productId).
+		Update("status", enum.ProductStatusDraft)
+	if result.Error != nil {
+		ctx.JSON(http.StatusInternalServerError, result.Error.Error())
+		return
+	}
+	if result.RowsAffected == 0 {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已下架")
+}
+
+func ListProductRevisions(ctx *gin.Context) {
+	var query PageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	db := boot.DB.Model(&model.ProductRevision{}).Where("product_id = ?", productId)
+	revisions, page, err := paginate(db, query, revisionPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	list := []ProductRevisionResponse{}
+	for _, r := range revisions {
+		content, err := decodeContent(r.Data)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		list = append(list, ProductRevisionResponse{
+			ID:        r.ID,
+			Version:   r.Version,
+			Note:      r.Note,
+			EditorID:  r.EditorID,
+			CreatedAt: r.CreatedAt,
+			Content:   content,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, ListProductRevisionsResponse{
+		List:     list,
+		PageInfo: page,
+	})
+}
+
+// 版本差異，預設和前一版比較，可用 compare 指定要比較的版本號
+func GetProductRevisionDiff(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	revision := model.ProductRevision{}
+	err := boot.DB.Where("product_id = ? AND version = ?", productId, ctx.Param("version")).First(&revision).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	compareVersion := uint64(revision.Version - 1)
+	if ctx.Query("compare") != "" {
+		compareVersion, err = strconv.ParseUint(ctx.Query("compare"), 10, 64)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	from := productContent{}
+	if compareVersion > 0 {
+		base := model.ProductRevision{}
+		err = boot.DB.Where("product_id = ? AND version = ?", productId, compareVersion).First(&base).Error
+		if err != nil {
+			ctx.JSON(http.StatusNotFound, err.Error())
+			return
+		}
+		from, err = decodeContent(base.Data)
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	to, err := decodeContent(revision.Data)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, RevisionDiffResponse{
+		FromVersion: uint(compareVersion),
+		ToVersion:   revision.Version,
+		Changes:     diffContent(from, to),
+	})
+}
+
+// 回復到指定版本並記錄成新版本，商品狀態不變，暫存的草稿不受影響
+func RollbackProductRevision(ctx *gin.Context) {
+	editorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	revision := model.ProductRevision{}
+	err = boot.DB.Where("product_id = ? AND version = ?", productId, ctx.Param("version")).First(&revision).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	content, err := decodeContent(revision.Data)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		product := model.Product{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, revision.ProductID).Error
+		if err != nil {
+			return err
+		}
+		content.applyTo(&product)
+
+		return saveProductRevision(tx, &product, &editorID, "回復到第 "+strconv.FormatUint(uint64(revision.Version), 10)+" 版", false)
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已回復")
+}
+
+// 發佈排程時間已到的草稿，由 job 定期呼叫
+func PublishScheduledProducts() error {
+	var drafts []model.ProductDraft
+	err := boot.DB.Where("publish_at <= ?", time.Now()).Find(&drafts).Error
+	if err != nil {
+		return err
+	}
+
+	for _, draft := range drafts {
+		err := boot.DB.Transaction(func(tx *gorm.DB) error {
+			// 鎖定後再確認排程沒有被改掉
+			current := model.ProductDraft{}
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("id = ? AND publish_at <= ?", draft.ID, time.Now()).
+				First(&current).Error
+			if err != nil {
+				return err
+			}
+
+			return publishProduct(tx, current.ProductID, current.EditorID, "排程發佈")
+		})
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("Publish scheduled product failed:", err)
+		}
+	}
+
+	return nil
+}
+
+// 前台只看得到已發佈的商品
+func isProductVisible(ctx *gin.Context, product model.Product) bool {
+	return product.Status == enum.ProductStatusPublished || isAdmin(ctx)
+}
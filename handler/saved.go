@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/model"
+)
+
+type MoveSavedItemToCartRequest struct {
+	Quantity uint // 沒填搬全部
+}
+
+// 購物車項目移到「下次再買」，同一商品數量合併
+func SaveCartItemForLater(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	cartItemId := ctx.Param("cartItemId")
+	cartItem := model.CartItem{}
+	err = boot.DB.Where("user_id = ?", userID).First(&cartItem, cartItemId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "product_id"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				"quantity":   gorm.Expr("saved_item.quantity + EXCLUDED.quantity"),
+				"updated_at": gorm.Expr("EXCLUDED.updated_at"),
+			}),
+		}).Create(&model.SavedItem{
+			UserID:    userID,
+			ProductID: cartItem.ProductID,
+			Quantity:  cartItem.Quantity,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&cartItem).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已移到下次再買")
+}
+
+// 「下次再買」移回購物車，數量檢查由 addCartItem 處理
+func MoveSavedItemToCart(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := MoveSavedItemToCartRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	savedItemId := ctx.Param("savedItemId")
+	item := model.SavedItem{}
+	err = boot.DB.Preload("Product").Where("user_id = ?", userID).First(&item, savedItemId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if req.Quantity == 0 || req.Quantity > item.Quantity {
+		req.Quantity = item.Quantity
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := addCartItem(tx, cartOwner{UserID: userID}, item.Product, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		// 只搬部分時保留剩下的
+		if req.Quantity < item.Quantity {
+			return tx.Model(&item).Update("quantity", item.Quantity-req.Quantity).Error
+		}
+
+		return tx.Delete(&item).Error
+	})
+	var quantityErr *CartQuantityError
+	if errors.As(err, &quantityErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已加入購物車")
+}
+
+func DeleteSavedItem(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	savedItemId := ctx.Param("savedItemId")
+	err = boot.DB.Where("user_id = ?", userID).Delete(&model.SavedItem{}, savedItemId).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 標記無法移回購物車的項目，並換算幣別與語系，需先 Preload Product
+func prepareSavedItems(ctx *gin.Context, items []model.SavedItem, rate currencyRate) error {
+	products := make([]model.Product, len(items))
+	for i := range items {
+		products[i] = items[i].Product
+	}
+	err := fillStockAvailability(products)
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].Unavailable = cartItemProblem(products[i], items[i].Quantity)
+	}
+
+	fillProductPrices(products, rate)
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		return err
+	}
+	for i := range items {
+		items[i].Product = products[i]
+	}
+
+	return nil
+}
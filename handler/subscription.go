@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type SubscribeStockRequest struct {
+	Email string `binding:"omitempty,email"` // 未登入時必填
+}
+
+// 缺貨商品的「到貨通知我」，登入會員用會員信箱，訪客需填信箱
+func SubscribeStock(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	product := model.Product{}
+	err := boot.DB.First(&product, productId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if product.Status != enum.ProductStatusPublished {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 看可售數量判斷，組合商品依組成商品計算
+	products := []model.Product{product}
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if products[0].IsDigital || products[0].StockQuantity > 0 {
+		ctx.JSON(http.StatusBadRequest, "商品還有庫存")
+		return
+	}
+
+	req := SubscribeStockRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	subscription := model.StockSubscription{
+		ProductID: product.ID,
+		Email:     req.Email,
+	}
+
+	// 有登入就綁定會員
+	if userID, err := getUserID(ctx); err == nil {
+		user := model.User{}
+		err = boot.DB.First(&user, userID).Error
+		if err != nil {
+			ctx.JSON(http.StatusInternalServerError, err.Error())
+			return
+		}
+		subscription.UserID = &user.ID
+		subscription.Email = user.Email
+	}
+
+	if subscription.Email == "" {
+		ctx.JSON(http.StatusBadRequest, "Email is required")
+		return
+	}
+
+	// 同一信箱尚未通知的訂閱只留一筆
+	var count int64
+	err = boot.DB.Model(&model.StockSubscription{}).
+		Where("product_id = ? AND email = ? AND notified_at IS NULL", product.ID, subscription.Email).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		ctx.JSON(http.StatusOK, "已訂閱")
+		return
+	}
+
+	err = boot.DB.Create(&subscription).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已訂閱")
+}
+
+// 庫存異動後的通知，在交易 commit 後呼叫，補貨通知會把組合商品和組成商品互相帶入檢查
+func notifyStockChange(productIDs []uint, levels stockLevels) {
+	notifyLowStock(levels)
+	notifyBackInStock(withBundleRelatedIDs(productIDs))
+}
+
+// 有庫存的商品通知所有尚未通知的訂閱者
+func notifyBackInStock(productIDs []uint) {
+	if len(productIDs) == 0 {
+		return
+	}
+
+	// 只通知買得到的商品，組合商品要算出可售數量才知道有沒有貨
+	var products []model.Product
+	err := boot.DB.Where("id IN ? AND status = ?", productIDs, enum.ProductStatusPublished).Find(&products).Error
+	if err != nil {
+		log.Println("Find products failed:", err)
+		return
+	}
+	err = fillStockAvailability(products)
+	if err != nil {
+		log.Println("Check bundle availability failed:", err)
+		return
+	}
+
+	available := map[uint]model.Product{}
+	var availableIDs []uint
+	for _, product := range products {
+		if product.StockQuantity > 0 {
+			available[product.ID] = product
+			availableIDs = append(availableIDs, product.ID)
+		}
+	}
+	if len(availableIDs) == 0 {
+		return
+	}
+
+	var subscriptions []model.StockSubscription
+	err = boot.DB.
+		Where("product_id IN ? AND notified_at IS NULL", availableIDs).
+		Find(&subscriptions).Error
+	if err != nil {
+		log.Println("Check stock subscriptions failed:", err)
+		return
+	}
+
+	for _, subscription := range subscriptions {
+		// 先標記已通知，搶到的才寄，確保只通知一次
+		result := boot.DB.Model(&model.StockSubscription{}).
+			Where("id = ? AND notified_at IS NULL", subscription.ID).
+			Update("notified_at", time.Now())
+		if result.Error != nil {
+			log.Println("Mark stock subscription failed:", result.Error)
+			continue
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		product := available[subscription.ProductID]
+
+		err := boot.Notify(context.Background(), boot.Notification{
+			Type:    "back_in_stock",
+			To:      subscription.Email,
+			Subject: "到貨通知",
+			Message: fmt.Sprintf("%v 已經補貨了", product.Name),
+			Data: map[string]any{
+				"ProductID": product.ID,
+			},
+		})
+		if err != nil {
+			log.Println("Send back in stock notification failed:", err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"path/filepath"
@@ -12,24 +13,28 @@ import (
 )
 
 type ListUsersQuery struct {
-	CurrentPage int    `binding:"required"`
-	PerPage     int    `binding:"required"`
-	Role        string `binding:"required"`
-	Name        string
+	PageQuery
+	Role string `binding:"required"`
+	Name string
 }
 
 type ListUsersResponse struct {
-	List  []model.User
-	Total int64
+	List []model.User
+	PageInfo
 }
 
 type ResetUserPasswordRequest struct {
 	Password string `binding:"required"`
 }
 
+var userPageOrder = pageOrder[model.User]{
+	Name: "user_id",
+	Keys: []pageKey[model.User]{
+		{Column: `"user".id`, Value: func(u model.User) any { return u.ID }},
+	},
+}
+
 func ListUsers(ctx *gin.Context) {
-	var users []model.User
-	var total int64
 	var query ListUsersQuery
 
 	// 自動綁定和驗證
@@ -49,22 +54,20 @@ func ListUsers(ctx *gin.Context) {
 		db = db.Where("name LIKE ?", "%"+query.Name+"%")
 	}
 
-	// 計算總數
-	db.Count(&total)
-
-	// 只有當 CurrentPage 和 PerPage 都是 -1 時才返回全部，否則必須分頁
-	if query.CurrentPage == -1 && query.PerPage == -1 {
-		// 返回全部資料
-		db.Find(&users)
-	} else {
-		// 分頁查詢
-		offset := (query.CurrentPage - 1) * query.PerPage
-		db.Offset(offset).Limit(query.PerPage).Find(&users)
+	// 分頁查詢
+	users, page, err := paginate(db, query.PageQuery, userPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	ctx.JSON(http.StatusOK, ListUsersResponse{
-		List:  users,
-		Total: total,
+		List:     users,
+		PageInfo: page,
 	})
 }
 
@@ -0,0 +1,431 @@
+package handler
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddWarehouseRequest struct {
+	Name      string `binding:"required"`
+	Address   string
+	Latitude  float64
+	Longitude float64
+	Priority  int
+	IsActive  bool
+}
+
+type TransferStockRequest struct {
+	ProductID       uint   `binding:"required"`
+	FromWarehouseID uint   `binding:"required"`
+	ToWarehouseID   uint   `binding:"required,nefield=FromWarehouseID"`
+	Quantity        uint   `binding:"required"`
+	Reason          string `binding:"required"`
+}
+
+type ListWarehousesResponse struct {
+	List []model.Warehouse
+	PageInfo
+}
+
+// 收件地點，用於 nearest 分倉策略
+type shippingLocation struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// 優先出貨的倉庫在前
+var warehousePageOrder = pageOrder[model.Warehouse]{
+	Name: "warehouse_priority",
+	Keys: []pageKey[model.Warehouse]{
+		{Column: "warehouse.priority", Value: func(w model.Warehouse) any { return w.Priority }},
+		{Column: "warehouse.id", Value: func(w model.Warehouse) any { return w.ID }},
+	},
+}
+
+func ListWarehouses(ctx *gin.Context) {
+	var query PageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	warehouses, page, err := paginate(boot.DB.Model(&model.Warehouse{}), query, warehousePageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, ListWarehousesResponse{
+		List:     warehouses,
+		PageInfo: page,
+	})
+}
+
+func AddWarehouse(ctx *gin.Context) {
+	req := AddWarehouseRequest{}
+	err := ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	warehouse := model.Warehouse{
+		Name:      req.Name,
+		Address:   req.Address,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Priority:  req.Priority,
+		IsActive:  req.IsActive,
+	}
+	err = boot.DB.Create(&warehouse).Error
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, warehouse)
+}
+
+func UpdateWarehouse(ctx *gin.Context) {
+	warehouseId := ctx.Param("warehouseId")
+	warehouse := model.Warehouse{}
+	err := boot.DB.First(&warehouse, warehouseId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	req := AddWarehouseRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	warehouse.Name = req.Name
+	warehouse.Address = req.Address
+	warehouse.Latitude = req.Latitude
+	warehouse.Longitude = req.Longitude
+	warehouse.Priority = req.Priority
+	warehouse.IsActive = req.IsActive
+	err = boot.DB.Save(&warehouse).Error
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "更新成功")
+}
+
+// 倉庫還有庫存時不能刪除
+func DeleteWarehouse(ctx *gin.Context) {
+	warehouseId := ctx.Param("warehouseId")
+	warehouse := model.Warehouse{}
+	err := boot.DB.First(&warehouse, warehouseId).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	var total int64
+	err = boot.DB.Model(&model.WarehouseStock{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("warehouse_id = ?", warehouse.ID).
+		Scan(&total).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if total > 0 {
+		ctx.JSON(http.StatusBadRequest, "倉庫還有庫存，請先調撥")
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("warehouse_id = ?", warehouse.ID).Delete(&model.WarehouseStock{}).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&warehouse).Error
+	})
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 商品在各倉庫的庫存
+func ListProductWarehouseStocks(ctx *gin.Context) {
+	productId := ctx.Param("productId")
+	stocks := []model.WarehouseStock{}
+	err := boot.DB.Preload("Warehouse").
+		Where("product_id = ?", productId).
+		Order("warehouse_id ASC").
+		Find(&stocks).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, stocks)
+}
+
+// 倉庫間調撥，總庫存不變
+func TransferStock(ctx *gin.Context) {
+	operatorID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := TransferStockRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var count int64
+	err = boot.DB.Model(&model.Warehouse{}).
+		Where("id IN ?", []uint{req.FromWarehouseID, req.ToWarehouseID}).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count != 2 {
+		ctx.JSON(http.StatusBadRequest, "warehouse not found")
+		return
+	}
+
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := changeStock(tx, nil, model.StockMovement{
+			ProductID:   req.ProductID,
+			Type:        enum.StockMovementTransfer,
+			Change:      -int(req.Quantity),
+			Reason:      req.Reason,
+			WarehouseID: &req.FromWarehouseID,
+			OperatorID:  &operatorID,
+		})
+		if err != nil {
+			return err
+		}
+
+		return changeStock(tx, nil, model.StockMovement{
+			ProductID:   req.ProductID,
+			Type:        enum.StockMovementTransfer,
+			Change:      int(req.Quantity),
+			Reason:      req.Reason,
+			WarehouseID: &req.ToWarehouseID,
+			OperatorID:  &operatorID,
+		})
+	})
+	if errors.Is(err, errNegativeStock) {
+		ctx.JSON(http.StatusBadRequest, "調出倉庫庫存不足")
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "調撥成功")
+}
+
+// 可售庫存 = 總庫存扣掉停用倉庫的庫存，停用倉庫不會出貨
+var sellableStockSQL = sellableStockOf("product")
+
+// table 是商品資料表或別名
+func sellableStockOf(table string) string {
+	return `(` + table + `.stock_quantity - COALESCE((
+	SELECT SUM(warehouse_stock.quantity) FROM warehouse_stock
+	JOIN warehouse ON warehouse.id = warehouse_stock.warehouse_id
+	WHERE warehouse_stock.product_id = ` + table + `.id AND warehouse.is_active = false), 0))`
+}
+
+var errNoActiveWarehouse = errors.New("沒有啟用中的倉庫")
+
+// 優先順序最高的啟用倉庫，還沒有倉庫時自動建立
+func defaultWarehouse(tx *gorm.DB) (model.Warehouse, error) {
+	warehouse := model.Warehouse{}
+	err := tx.Where("is_active = ?", true).Order("priority ASC, id ASC").Limit(1).Find(&warehouse).Error
+	if err != nil || warehouse.ID != 0 {
+		return warehouse, err
+	}
+
+	// 預設倉庫被停用時不自動啟用，由管理員處理
+	warehouse = model.Warehouse{Name: "預設倉庫", IsActive: true}
+	err = tx.Where("name = ?", warehouse.Name).FirstOrCreate(&warehouse).Error
+	if err == nil && !warehouse.IsActive {
+		return warehouse, errNoActiveWarehouse
+	}
+
+	return warehouse, err
+}
+
+// 商品在停用倉庫的庫存
+func inactiveWarehouseStock(tx *gorm.DB, productID uint) (uint, error) {
+	var sum int64
+	err := tx.Model(&model.WarehouseStock{}).
+		Select("COALESCE(SUM(warehouse_stock.quantity), 0)").
+		Joins("JOIN warehouse ON warehouse.id = warehouse_stock.warehouse_id").
+		Where("warehouse_stock.product_id = ? AND warehouse.is_active = ?", productID, false).
+		Scan(&sum).Error
+	return uint(sum), err
+}
+
+// 依 WAREHOUSE_ALLOCATION 設定的策略決定每個訂單細項從哪些倉庫出貨
+// 必須在交易中呼叫
+func allocateWarehouses(tx *gorm.DB, items []model.OrderItem, location *shippingLocation) ([]model.OrderItemAllocation, error) {
+	strategy := enum.AllocationStrategy(os.Getenv("WAREHOUSE_ALLOCATION"))
+	if strategy == "" {
+		strategy = enum.AllocationPriority
+	}
+
+	var warehouses []model.Warehouse
+	err := tx.Where("is_active = ?", true).Order("priority ASC, id ASC").Find(&warehouses).Error
+	if err != nil {
+		return nil, err
+	}
+
+	_, productIDs := sumItemQuantities(items)
+
+	var stocks []model.WarehouseStock
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("product_id IN ?", productIDs).
+		Order("id").
+		Find(&stocks).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return planAllocations(strategy, warehouses, stocks, items, location)
+}
+
+// 依策略用倉庫庫存分配訂單細項，庫存不足回傳 OutOfStockError
+func planAllocations(strategy enum.AllocationStrategy, warehouses []model.Warehouse, stocks []model.WarehouseStock, items []model.OrderItem, location *shippingLocation) ([]model.OrderItemAllocation, error) {
+	// 最近的倉庫排前面
+	if strategy == enum.AllocationNearest && location != nil {
+		warehouses = slices.Clone(warehouses)
+		slices.SortStableFunc(warehouses, func(a, b model.Warehouse) int {
+			da := distanceKm(location.Latitude, location.Longitude, a.Latitude, a.Longitude)
+			db := distanceKm(location.Latitude, location.Longitude, b.Latitude, b.Longitude)
+			switch {
+			case da < db:
+				return -1
+			case da > db:
+				return 1
+			}
+			return 0
+		})
+	}
+
+	quantities, _ := sumItemQuantities(items)
+
+	// 倉庫 => 商品 => 可用數量
+	available := map[uint]map[uint]uint{}
+	for _, w := range warehouses {
+		available[w.ID] = map[uint]uint{}
+	}
+	for _, stock := range stocks {
+		if _, ok := available[stock.WarehouseID]; ok {
+			available[stock.WarehouseID][stock.ProductID] = stock.Quantity
+		}
+	}
+
+	var allocations []model.OrderItemAllocation
+
+	// 先找能整單出貨的倉庫
+	if strategy != enum.AllocationSplit {
+		for _, w := range warehouses {
+			fulfilled := true
+			for id, quantity := range quantities {
+				if available[w.ID][id] < quantity {
+					fulfilled = false
+					break
+				}
+			}
+			if !fulfilled {
+				continue
+			}
+
+			for _, item := range items {
+				allocations = append(allocations, model.OrderItemAllocation{
+					OrderItemID: item.ID,
+					ProductID:   item.ProductID,
+					WarehouseID: w.ID,
+					Quantity:    item.Quantity,
+				})
+			}
+			return allocations, nil
+		}
+	}
+
+	// 拆單，依倉庫順序逐一扣
+	outOfStock := &OutOfStockError{}
+	for _, item := range items {
+		remaining := item.Quantity
+		for _, w := range warehouses {
+			take := min(remaining, available[w.ID][item.ProductID])
+			if take == 0 {
+				continue
+			}
+
+			available[w.ID][item.ProductID] -= take
+			remaining -= take
+			allocations = append(allocations, model.OrderItemAllocation{
+				OrderItemID: item.ID,
+				ProductID:   item.ProductID,
+				WarehouseID: w.ID,
+				Quantity:    take,
+			})
+
+			if remaining == 0 {
+				break
+			}
+		}
+
+		if remaining > 0 {
+			outOfStock.Items = append(outOfStock.Items, OutOfStockItem{
+				ProductID: item.ProductID,
+				Requested: item.Quantity,
+				Available: item.Quantity - remaining,
+			})
+		}
+	}
+	if len(outOfStock.Items) > 0 {
+		return nil, outOfStock
+	}
+
+	return allocations, nil
+}
+
+// 兩點間球面距離（公里）
+func distanceKm(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadiusKm = 6371
+	toRad := func(deg float64) float64 { return deg * math.Pi / 180 }
+
+	dLat := toRad(lat2 - lat1)
+	dLng := toRad(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRad(lat1))*math.Cos(toRad(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+
+	return earthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
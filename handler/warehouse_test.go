@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+// 台北倉優先順序高，高雄倉在南部
+var testWarehouses = []model.Warehouse{
+	{ID: 1, Name: "台北倉", Latitude: 25.03, Longitude: 121.56, Priority: 1, IsActive: true},
+	{ID: 2, Name: "高雄倉", Latitude: 22.63, Longitude: 120.30, Priority: 2, IsActive: true},
+}
+
+func TestPlanAllocations(t *testing.T) {
+	kaohsiung := &shippingLocation{Latitude: 22.62, Longitude: 120.31}
+
+	tests := []struct {
+		name     string
+		strategy enum.AllocationStrategy
+		stocks   []model.WarehouseStock
+		items    []model.OrderItem
+		location *shippingLocation
+		want     []model.OrderItemAllocation
+	}{
+		{
+			name:     "priority 整單從優先倉庫出貨",
+			strategy: enum.AllocationPriority,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 10, Quantity: 5},
+			},
+			items:    []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 3}},
+			location: kaohsiung,
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 1, Quantity: 3},
+			},
+		},
+		{
+			name:     "priority 優先倉庫無法整單時找下一個能整單的倉庫",
+			strategy: enum.AllocationPriority,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 11, Quantity: 1},
+			},
+			items: []model.OrderItem{
+				{ID: 100, ProductID: 10, Quantity: 2},
+				{ID: 101, ProductID: 11, Quantity: 1},
+			},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 2},
+				{OrderItemID: 101, ProductID: 11, WarehouseID: 2, Quantity: 1},
+			},
+		},
+		{
+			name:     "priority 沒有倉庫能整單時拆單",
+			strategy: enum.AllocationPriority,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 2},
+				{WarehouseID: 2, ProductID: 10, Quantity: 2},
+			},
+			items: []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 3}},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 1, Quantity: 2},
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 1},
+			},
+		},
+		{
+			name:     "nearest 從最近的倉庫出貨",
+			strategy: enum.AllocationNearest,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 10, Quantity: 5},
+			},
+			items:    []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 3}},
+			location: kaohsiung,
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 3},
+			},
+		},
+		{
+			name:     "nearest 沒有收件地點時依優先順序",
+			strategy: enum.AllocationNearest,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 10, Quantity: 5},
+			},
+			items: []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 3}},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 1, Quantity: 3},
+			},
+		},
+		{
+			name:     "split 每個商品依優先順序扣",
+			strategy: enum.AllocationSplit,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 1},
+				{WarehouseID: 2, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 11, Quantity: 5},
+			},
+			items: []model.OrderItem{
+				{ID: 100, ProductID: 10, Quantity: 3},
+				{ID: 101, ProductID: 11, Quantity: 1},
+			},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 1, Quantity: 1},
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 2},
+				{OrderItemID: 101, ProductID: 11, WarehouseID: 2, Quantity: 1},
+			},
+		},
+		{
+			name:     "同商品多個細項合併計算整單",
+			strategy: enum.AllocationPriority,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 3},
+				{WarehouseID: 2, ProductID: 10, Quantity: 4},
+			},
+			items: []model.OrderItem{
+				{ID: 100, ProductID: 10, Quantity: 2},
+				{ID: 101, ProductID: 10, Quantity: 2},
+			},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 2},
+				{OrderItemID: 101, ProductID: 10, WarehouseID: 2, Quantity: 2},
+			},
+		},
+		{
+			name:     "不在啟用倉庫清單的庫存不分配",
+			strategy: enum.AllocationSplit,
+			stocks: []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 1},
+				{WarehouseID: 3, ProductID: 10, Quantity: 5},
+				{WarehouseID: 2, ProductID: 10, Quantity: 1},
+			},
+			items: []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 2}},
+			want: []model.OrderItemAllocation{
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 1, Quantity: 1},
+				{OrderItemID: 100, ProductID: 10, WarehouseID: 2, Quantity: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := planAllocations(tt.strategy, testWarehouses, tt.stocks, tt.items, tt.location)
+			if err != nil {
+				t.Fatalf("planAllocations() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("planAllocations() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanAllocationsOutOfStock(t *testing.T) {
+	for _, strategy := range []enum.AllocationStrategy{enum.AllocationPriority, enum.AllocationNearest, enum.AllocationSplit} {
+		t.Run(string(strategy), func(t *testing.T) {
+			stocks := []model.WarehouseStock{
+				{WarehouseID: 1, ProductID: 10, Quantity: 2},
+				{WarehouseID: 2, ProductID: 10, Quantity: 1},
+				{WarehouseID: 1, ProductID: 11, Quantity: 5},
+			}
+			items := []model.OrderItem{
+				{ID: 100, ProductID: 10, Quantity: 4},
+				{ID: 101, ProductID: 11, Quantity: 1},
+			}
+
+			got, err := planAllocations(strategy, testWarehouses, stocks, items, nil)
+			if got != nil {
+				t.Errorf("planAllocations() = %+v, want nil", got)
+			}
+
+			var outOfStock *OutOfStockError
+			if !errors.As(err, &outOfStock) {
+				t.Fatalf("planAllocations() error = %v, want OutOfStockError", err)
+			}
+			want := []OutOfStockItem{{ProductID: 10, Requested: 4, Available: 3}}
+			if !reflect.DeepEqual(outOfStock.Items, want) {
+				t.Errorf("OutOfStockError.Items = %+v, want %+v", outOfStock.Items, want)
+			}
+		})
+	}
+}
+
+func TestPlanAllocationsKeepsWarehouseOrder(t *testing.T) {
+	warehouses := []model.Warehouse{testWarehouses[0], testWarehouses[1]}
+	stocks := []model.WarehouseStock{{WarehouseID: 2, ProductID: 10, Quantity: 1}}
+	items := []model.OrderItem{{ID: 100, ProductID: 10, Quantity: 1}}
+
+	_, err := planAllocations(enum.AllocationNearest, warehouses, stocks, items, &shippingLocation{Latitude: 22.62, Longitude: 120.31})
+	if err != nil {
+		t.Fatalf("planAllocations() error = %v", err)
+	}
+	if warehouses[0].ID != 1 || warehouses[1].ID != 2 {
+		t.Errorf("planAllocations() reordered caller warehouses: %+v", warehouses)
+	}
+}
+
+func TestDistanceKm(t *testing.T) {
+	// 台北車站到高雄車站約 300 公里
+	got := distanceKm(25.0478, 121.5170, 22.6394, 120.3025)
+	if got < 290 || got > 310 {
+		t.Errorf("distanceKm() = %v, want about 300", got)
+	}
+	if got := distanceKm(25.0478, 121.5170, 25.0478, 121.5170); got != 0 {
+		t.Errorf("distanceKm() same point = %v, want 0", got)
+	}
+}
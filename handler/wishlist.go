@@ -0,0 +1,266 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"shop.go/boot"
+	"shop.go/enum"
+	"shop.go/model"
+)
+
+type AddWishlistItemRequest struct {
+	ProductID uint `binding:"required"`
+}
+
+type MoveWishlistItemToCartRequest struct {
+	Quantity uint
+}
+
+type WishlistReportQuery struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+type WishlistReportRow struct {
+	ProductID uint
+	Name      string
+	Count     int64
+}
+
+type ListWishlistItemsResponse struct {
+	List []model.WishlistItem
+	PageInfo
+}
+
+// 最近加入的在前
+var wishlistPageOrder = pageOrder[model.WishlistItem]{
+	Name: "wishlist_newest",
+	Keys: []pageKey[model.WishlistItem]{
+		{Column: "wishlist_item.created_at", Desc: true, Value: func(w model.WishlistItem) any { return w.CreatedAt }},
+		{Column: "wishlist_item.id", Desc: true, Value: func(w model.WishlistItem) any { return w.ID }},
+	},
+}
+
+func ListWishlistItems(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var query PageQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	db := boot.DB.Model(&model.WishlistItem{}).Preload("Product").Where("user_id = ?", userID)
+	items, page, err := paginate(db, query, wishlistPageOrder)
+	if errors.Is(err, errInvalidCursor) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 可售數量
+	products := make([]model.Product, len(items))
+	for i := range items {
+		products[i] = items[i].Product
+	}
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// 降價、補貨標記
+	for i := range items {
+		items[i].PriceDropped = effectivePrice(products[i]) < items[i].PriceAtAdd
+		items[i].BackInStock = items[i].WasOutOfStock && products[i].StockQuantity > 0
+	}
+
+	// 顯示幣別價格
+	rate, err := resolveCurrency(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	fillProductPrices(products, rate)
+
+	// 語系
+	err = localizeProducts(products, resolveLocale(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range items {
+		items[i].Product = products[i]
+	}
+
+	ctx.JSON(http.StatusOK, ListWishlistItemsResponse{
+		List:     items,
+		PageInfo: page,
+	})
+}
+
+func AddWishlistItem(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := AddWishlistItemRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	product := model.Product{}
+	err = boot.DB.First(&product, req.ProductID).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+	if product.Status != enum.ProductStatusPublished {
+		ctx.JSON(http.StatusNotFound, "product not found")
+		return
+	}
+
+	// 看可售數量判斷缺貨
+	products := []model.Product{product}
+	err = fillStockAvailability(products)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	product = products[0]
+
+	var count int64
+	err = boot.DB.Model(&model.WishlistItem{}).
+		Where("user_id = ? AND product_id = ?", userID, product.ID).
+		Count(&count).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if count > 0 {
+		ctx.JSON(http.StatusConflict, "已在願望清單中")
+		return
+	}
+
+	item := model.WishlistItem{
+		UserID:        userID,
+		ProductID:     product.ID,
+		PriceAtAdd:    effectivePrice(product),
+		WasOutOfStock: product.StockQuantity == 0,
+	}
+	err = boot.DB.Create(&item).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "success")
+}
+
+func DeleteWishlistItem(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	productId := ctx.Param("productId")
+	err = boot.DB.Where("user_id = ? AND product_id = ?", userID, productId).
+		Delete(&model.WishlistItem{}).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已刪除")
+}
+
+// 從願望清單移到購物車
+func MoveWishlistItemToCart(ctx *gin.Context) {
+	userID, err := getUserID(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	req := MoveWishlistItemToCartRequest{}
+	err = ctx.ShouldBindBodyWithJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	productId := ctx.Param("productId")
+	item := model.WishlistItem{}
+	err = boot.DB.Preload("Product").
+		Where("user_id = ? AND product_id = ?", userID, productId).
+		First(&item).Error
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, err.Error())
+		return
+	}
+
+	// 和購物車既有項目合併，數量檢查由 addCartItem 處理
+	err = boot.DB.Transaction(func(tx *gorm.DB) error {
+		err := addCartItem(tx, cartOwner{UserID: userID}, item.Product, req.Quantity)
+		if err != nil {
+			return err
+		}
+
+		return tx.Delete(&item).Error
+	})
+	var quantityErr *CartQuantityError
+	if errors.As(err, &quantityErr) {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, "已加入購物車")
+}
+
+// 最多人加入願望清單的商品
+func GetWishlistReport(ctx *gin.Context) {
+	var query WishlistReportQuery
+	if err := ctx.ShouldBindQuery(&query); err != nil {
+		ctx.JSON(http.StatusBadRequest, err.Error())
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = 20
+	}
+
+	rows := []WishlistReportRow{}
+	err := boot.DB.Model(&model.WishlistItem{}).
+		Select("wishlist_item.product_id, product.name, COUNT(*) AS count").
+		Joins("JOIN product ON product.id = wishlist_item.product_id").
+		Group("wishlist_item.product_id, product.name").
+		Order("count DESC, wishlist_item.product_id ASC").
+		Limit(query.Limit).
+		Scan(&rows).Error
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, rows)
+}
@@ -0,0 +1,31 @@
+package job
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"shop.go/handler"
+)
+
+// 定期提醒閒置購物車並清除過期購物車，間隔由 CART_REMINDER_INTERVAL 設定（預設 1h）
+func StartAbandonedCartReminders() {
+	interval, err := time.ParseDuration(os.Getenv("CART_REMINDER_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		for {
+			err := handler.RemindAbandonedCarts()
+			if err != nil {
+				log.Println("Remind abandoned carts failed:", err)
+			}
+			err = handler.ExpireAbandonedCarts()
+			if err != nil {
+				log.Println("Expire abandoned carts failed:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -0,0 +1,27 @@
+package job
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"shop.go/handler"
+)
+
+// 定期發佈排程時間已到的商品草稿，間隔由 PRODUCT_PUBLISH_INTERVAL 設定（預設 1m）
+func StartScheduledPublishing() {
+	interval, err := time.ParseDuration(os.Getenv("PRODUCT_PUBLISH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Minute
+	}
+
+	go func() {
+		for {
+			err := handler.PublishScheduledProducts()
+			if err != nil {
+				log.Println("Publish scheduled products failed:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
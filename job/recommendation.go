@@ -0,0 +1,27 @@
+package job
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"shop.go/handler"
+)
+
+// 定期重新計算商品共同購買統計，間隔由 RECOMMENDATION_REFRESH_INTERVAL 設定（預設 1h）
+func StartRecommendationRefresh() {
+	interval, err := time.ParseDuration(os.Getenv("RECOMMENDATION_REFRESH_INTERVAL"))
+	if err != nil || interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		for {
+			err := handler.RefreshProductRelations()
+			if err != nil {
+				log.Println("Refresh product relations failed:", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"log"
 	"os"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"shop.go/boot"
+	"shop.go/job"
 	"shop.go/middleware"
 	"shop.go/routes"
 )
@@ -14,10 +17,28 @@ func main() {
 	boot.LoadEnvFile()
 	boot.ConnectDB()
 	boot.ConnectStorage()
+	boot.ConnectNotifier()
+
+	// 背景排程
+	job.StartRecommendationRefresh()
+	job.StartScheduledPublishing()
+	job.StartAbandonedCartReminders()
 
 	// 創建 Gin 路由器
 	router := gin.Default()
 
+	// 只信任設定的反向代理，其他來源的 X-Forwarded-For 不採用，ClientIP 才不會被偽造
+	var proxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	err := router.SetTrustedProxies(proxies)
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// CORS 設定
 	router.Use(middleware.CORS())
 
@@ -59,26 +59,65 @@ func Auth(userRoleList ...enum.UserRole) gin.HandlerFunc {
 			return
 		}
 
-		userRole := enum.UserRole(claims["user_role"].(string))
-		if !slices.Contains(userRoleList, userRole) {
+		userRole, ok := claims["user_role"].(string)
+		if !ok {
+			ctx.JSON(http.StatusUnauthorized, "user_role not exists")
+			ctx.Abort()
+			return
+		}
+		if !slices.Contains(userRoleList, enum.UserRole(userRole)) {
 			ctx.JSON(http.StatusUnauthorized, "身份錯誤")
 			ctx.Abort()
 			return
 		}
 
-		if claims["user_id"] == nil {
+		userID, ok := claims["user_id"].(string)
+		if !ok {
 			ctx.JSON(http.StatusUnauthorized, "user_id not exists")
 			ctx.Abort()
 			return
 		}
-		ctx.Set("user_id", claims["user_id"].(string))
+		ctx.Set("user_id", userID)
+		ctx.Set("user_role", userRole)
 
-		if claims["user_role"] == nil {
-			ctx.JSON(http.StatusUnauthorized, "user_role not exists")
-			ctx.Abort()
+		ctx.Next()
+	}
+}
+
+// 有帶合法 token 就設定 user_id、user_role，沒帶或不合法當作訪客繼續
+func OptionalAuth() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		tokenString, err := getTokenStringFromAuthorizationHeader(ctx)
+		if err != nil {
+			ctx.Next()
+			return
+		}
+
+		token, err := utils.ValidateToken(tokenString)
+		if err != nil || !token.Valid {
+			ctx.Next()
+			return
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			ctx.Next()
 			return
 		}
-		ctx.Set("user_role", claims["user_role"].(string))
+
+		userID, ok := claims["user_id"].(string)
+		if !ok {
+			ctx.Next()
+			return
+		}
+		userRole, ok := claims["user_role"].(string)
+		if !ok {
+			ctx.Next()
+			return
+		}
+
+		ctx.Set("user_id", userID)
+		ctx.Set("user_role", userRole)
 
 		ctx.Next()
 	}
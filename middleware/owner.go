@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"shop.go/enum"
+	"shop.go/utils"
+)
+
+// 資源的擁有者，會員或訪客購物車擇一
+type ResourceOwner struct {
+	UserID      *uint
+	GuestCartID *string
+}
+
+// 用路由參數查出資源的擁有者，找不到回傳 error
+type OwnerLookup func(id string) (ResourceOwner, error)
+
+// 只有資源擁有者能繼續，管理員不受限；不是自己的資源一律回 404，不透露資源是否存在
+// 需放在 Auth 或 OptionalAuth 之後
+func Owner(param string, lookup OwnerLookup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if ctx.GetString("user_role") == string(enum.RoleAdmin) {
+			ctx.Next()
+			return
+		}
+
+		owner, err := lookup(ctx.Param(param))
+		if err != nil || !isResourceOwner(ctx, owner) {
+			ctx.JSON(http.StatusNotFound, "not found")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// 比對登入會員或 X-Cart-Token 的訪客購物車
+func isResourceOwner(ctx *gin.Context, owner ResourceOwner) bool {
+	if owner.UserID != nil {
+		userID, err := strconv.ParseUint(ctx.GetString("user_id"), 10, 64)
+		return err == nil && uint(userID) == *owner.UserID
+	}
+
+	if owner.GuestCartID != nil {
+		// 已登入會員用會員購物車
+		if ctx.GetString("user_id") != "" {
+			return false
+		}
+		cartID, err := utils.ValidateCartToken(ctx.GetHeader("X-Cart-Token"))
+		return err == nil && cartID == *owner.GuestCartID
+	}
+
+	return false
+}
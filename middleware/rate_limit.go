@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 依來源 IP 限制每段時間內的請求次數，計數只存在記憶體
+func RateLimit(limit int, window time.Duration) gin.HandlerFunc {
+	type counter struct {
+		count   int
+		resetAt time.Time
+	}
+
+	var mu sync.Mutex
+	counters := map[string]*counter{}
+
+	// 定期清掉過期的計數，避免 map 一直長大
+	go func() {
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			mu.Lock()
+			for key, c := range counters {
+				if now.After(c.resetAt) {
+					delete(counters, key)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	return func(ctx *gin.Context) {
+		now := time.Now()
+		ip := ctx.ClientIP()
+
+		mu.Lock()
+		c, ok := counters[ip]
+		if !ok || now.After(c.resetAt) {
+			c = &counter{resetAt: now.Add(window)}
+			counters[ip] = c
+		}
+		c.count++
+		exceeded := c.count > limit
+		mu.Unlock()
+
+		if exceeded {
+			ctx.JSON(http.StatusTooManyRequests, "請求太頻繁，請稍後再試")
+			ctx.Abort()
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -18,48 +18,273 @@ type User struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time `json:"-"`
 
-	CartItems []CartItem
-	Orders    []Order   `json:"-"`
-	Comments  []Comment `json:"-"`
+	CartItems     []CartItem
+	SavedItems    []SavedItem
+	Orders        []Order        `json:"-"`
+	Comments      []Comment      `json:"-"`
+	WishlistItems []WishlistItem `json:"-"`
 }
 
 type Category struct {
-	ID          uint   `gorm:"primaryKey"`
-	Name        string `gorm:"unique"`
+	ID                uint   `gorm:"primaryKey"`
+	Name              string `gorm:"unique"`
+	Description       string
+	LowStockThreshold *uint `gorm:"default:5"` // 商品沒設定時使用的低庫存門檻
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+
+	Products     []Product             `json:"-"`
+	Translations []CategoryTranslation `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+
+	Locale string `gorm:"-"` // 回傳內容的語系
+}
+
+// 種類的多語系內容，預設語系直接存在 Category
+type CategoryTranslation struct {
+	ID          uint
+	CategoryID  uint   `gorm:"uniqueIndex:idx_category_locale"`
+	Locale      string `gorm:"uniqueIndex:idx_category_locale"`
+	Name        string
 	Description string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
-
-	Products []Product `json:"-"`
 }
 
 type Product struct {
-	ID            uint `gorm:"primaryKey"`
-	CategoryID    uint
-	Name          string
-	Description   string
-	Price         float64
-	StockQuantity uint
-	ImageURL      string
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
+	ID                uint `gorm:"primaryKey"`
+	CategoryID        uint
+	Name              string
+	Description       string
+	Price             float64
+	SalePrice         *float64   // 特價，在特價期間內取代 Price
+	SaleStartAt       *time.Time // 空值代表立即開始
+	SaleEndAt         *time.Time // 空值代表沒有結束時間
+	StockQuantity     uint
+	LowStockThreshold *uint  // 空值時使用種類預設值
+	MaxPerOrder       *uint  // 每筆訂單購買上限，空值代表不限
+	IsBundle          bool   // 組合商品，庫存由組成商品計算
+	IsDigital         bool   // 數位商品，不需出貨也不扣庫存
+	DigitalFile       string `json:"-"` // 數位商品在 bucket 的私有檔名
+	ImageURL          string
+	Status            enum.ProductStatus `gorm:"default:published"` // 草稿不會出現在前台
+	PublishedAt       *time.Time
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
 
 	Category   Category    // 加這行，用來接收 Category 資料
 	CartItems  []CartItem  `json:"-"`
 	OrderItems []OrderItem `json:"-"`
 	Comments   []Comment   `json:"-"`
+
+	BundleComponents []BundleComponent    `gorm:"foreignKey:BundleID" json:",omitempty"`
+	Translations     []ProductTranslation `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Draft            *ProductDraft        `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Questions        []ProductQuestion    `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+	Revisions        []ProductRevision    `gorm:"constraint:OnDelete:CASCADE" json:"-"`
+
+	Rating       ProductRating `gorm:"-"` // 評價統計，查詢後計算
+	Currency     string        `gorm:"-"` // 顯示幣別
+	DisplayPrice float64       `gorm:"-"` // 換算後價格
+	Locale       string        `gorm:"-"` // 回傳內容的語系
+
+	TopQuestions []ProductQuestion `gorm:"-" json:",omitempty"` // 熱門已回答問題
+}
+
+// 商品尚未發佈的編輯，Data 是 JSON 格式的商品內容
+type ProductDraft struct {
+	ID        uint
+	ProductID uint   `gorm:"uniqueIndex"`
+	Data      string `json:"-"`
+	EditorID  *uint
+	PublishAt *time.Time `gorm:"index"` // 排程發佈時間
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 每次發佈的商品內容快照
+type ProductRevision struct {
+	ID        uint
+	ProductID uint   `gorm:"uniqueIndex:idx_product_version"`
+	Version   uint   `gorm:"uniqueIndex:idx_product_version"`
+	Data      string `json:"-"`
+	Note      string
+	EditorID  *uint
+	CreatedAt time.Time
+}
+
+// 商品的多語系內容，預設語系直接存在 Product
+type ProductTranslation struct {
+	ID          uint
+	ProductID   uint   `gorm:"uniqueIndex:idx_product_locale"`
+	Locale      string `gorm:"uniqueIndex:idx_product_locale"`
+	Name        string
+	Description string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// 組合商品的組成
+type BundleComponent struct {
+	ID          uint
+	BundleID    uint `gorm:"index"`
+	ComponentID uint
+	Quantity    uint // 每組需要幾個
+
+	Component Product `gorm:"foreignKey:ComponentID"`
+}
+
+// 庫存流水帳，每次庫存異動一筆
+type StockMovement struct {
+	ID           uint
+	ProductID    uint `gorm:"index"`
+	Type         enum.StockMovementType
+	Change       int    // 正數入庫、負數出庫
+	BalanceAfter uint   // 異動後庫存
+	Reason       string // 手動調整原因
+	OrderID      *uint
+	WarehouseID  *uint `gorm:"index"`
+	OperatorID   *uint // 操作的管理員
+	CreatedAt    time.Time
+}
+
+type Warehouse struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"unique"`
+	Address   string
+	Latitude  float64
+	Longitude float64
+	Priority  int // 數字小的優先出貨
+	IsActive  bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// 各倉庫庫存，加總等於 Product.StockQuantity
+type WarehouseStock struct {
+	ID          uint `gorm:"primaryKey"`
+	WarehouseID uint `gorm:"uniqueIndex:idx_warehouse_stock_product"`
+	ProductID   uint `gorm:"uniqueIndex:idx_warehouse_stock_product"`
+	Quantity    uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	Warehouse Warehouse
+}
+
+// 數位商品下載連結，綁定買家且有期限與次數限制
+type DigitalDownload struct {
+	ID            uint
+	OrderItemID   uint `gorm:"index"`
+	UserID        uint
+	ProductID     uint
+	Token         string `gorm:"uniqueIndex" json:"-"`
+	ExpiresAt     time.Time
+	DownloadCount uint
+	MaxDownloads  uint
+	CreatedAt     time.Time
+}
+
+// 補貨通知訂閱，每筆只通知一次
+type StockSubscription struct {
+	ID         uint
+	ProductID  uint `gorm:"index"`
+	UserID     *uint
+	Email      string
+	NotifiedAt *time.Time
+	CreatedAt  time.Time
 }
 
 type CartItem struct {
+	ID          uint    `gorm:"primaryKey"`
+	UserID      *uint   `gorm:"index"` // 會員購物車
+	GuestCartID *string `gorm:"index"` // 訪客購物車，和 UserID 擇一
+	ProductID   uint
+	Quantity    uint
+	UnitPrice   float64 // 目前售價，讀取購物車時由伺服器重新計算
+	PriceAtAdd  float64 // 加入購物車當時的售價
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+
+	Product Product
+
+	PriceChanged     bool    `gorm:"-"` // 售價和加入時不同
+	Unavailable      string  `gorm:"-"` // 無法購買的原因，空字串代表可購買
+	Currency         string  `gorm:"-"` // 顯示幣別
+	DisplayUnitPrice float64 `gorm:"-"` // 換算後單價
+}
+
+// 購物車的「下次再買」清單，不會被結帳
+type SavedItem struct {
 	ID        uint `gorm:"primaryKey"`
-	UserID    uint
-	ProductID uint
+	UserID    uint `gorm:"uniqueIndex:idx_saved_user_product"`
+	ProductID uint `gorm:"uniqueIndex:idx_saved_user_product"`
 	Quantity  uint
-	UnitPrice float64
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
 	Product Product
+
+	Unavailable string `gorm:"-"` // 無法移回購物車的原因
+}
+
+// 訪客購物車，用簽章過的 cart token 識別，登入後併入會員購物車
+type GuestCart struct {
+	ID        string `gorm:"primaryKey"` // uuid
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	CartItems []CartItem `gorm:"constraint:OnDelete:CASCADE" json:",omitempty"`
+}
+
+// 購物車閒置提醒，之後下單就算挽回
+type CartReminder struct {
+	ID           uint
+	UserID       uint      `gorm:"index"`
+	LastActivity time.Time // 寄送時購物車最後異動時間
+	ItemCount    uint
+	SentAt       time.Time
+	RecoveredAt  *time.Time
+	OrderID      *uint
+	CreatedAt    time.Time
+}
+
+// 優惠券，金額以基準幣計算
+type Coupon struct {
+	ID          uint
+	Code        string          `gorm:"unique"`
+	Type        enum.CouponType // percent 時 Value 為百分比
+	Value       float64
+	MinSubtotal float64    // 小計門檻
+	StartAt     *time.Time // 沒填立即開始
+	EndAt       *time.Time // 沒填不會結束
+	UsageLimit  *uint      // 沒填不限次數
+	UsedCount   uint
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// 匯率，1 基準幣 = Rate 外幣
+type ExchangeRate struct {
+	ID        uint
+	Currency  string `gorm:"uniqueIndex"`
+	Rate      float64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WishlistItem struct {
+	ID            uint    `gorm:"primaryKey"`
+	UserID        uint    `gorm:"uniqueIndex:idx_wishlist_user_product"`
+	ProductID     uint    `gorm:"uniqueIndex:idx_wishlist_user_product"`
+	PriceAtAdd    float64 // 加入時的價格，用來判斷降價
+	WasOutOfStock bool    // 加入時是否缺貨，用來判斷補貨
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+
+	Product Product
+
+	PriceDropped bool `gorm:"-"`
+	BackInStock  bool `gorm:"-"`
 }
 
 type Order struct {
@@ -69,7 +294,15 @@ type Order struct {
 	RecipientPhone   string
 	RecipientEmail   string
 	RecipientAddress string
-	TotalAmount      float64
+	Subtotal         float64 // 商品小計
+	CouponCode       string
+	DiscountAmount   float64
+	ShippingFee      float64
+	TaxAmount        float64
+	TotalAmount      float64 // 基準幣應付總額
+	Currency         string  // 付款幣別
+	ExchangeRate     float64 `gorm:"default:1"` // 下單當時匯率
+	ChargedAmount    float64 // 付款幣別金額
 	PaymentMethod    string
 	Status           enum.OrderStatus
 	CreatedAt        time.Time
@@ -87,17 +320,78 @@ type OrderItem struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
-	Product Product
+	Product     Product
+	Allocations []OrderItemAllocation `json:",omitempty"`
+}
+
+// 訂單細項從哪個倉庫出貨
+type OrderItemAllocation struct {
+	ID          uint
+	OrderItemID uint `gorm:"index"`
+	ProductID   uint // 實際出貨的商品，組合商品為組成商品
+	WarehouseID uint
+	Quantity    uint
+	CreatedAt   time.Time
 }
 
 type Comment struct {
 	ID        uint
-	UserID    uint
-	ProductID uint
+	UserID    uint `gorm:"uniqueIndex:idx_comment_user_product"` // 每個商品每人只能評價一次
+	ProductID uint `gorm:"uniqueIndex:idx_comment_user_product"`
 	Content   string
 	Rating    uint
+	Status    enum.CommentStatus `gorm:"default:approved"`
+	Reply     string             // 商店公開回覆
+	RepliedAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	User    User
+	Reports []CommentReport `json:",omitempty"`
+}
+
+// 商品問答的提問
+type ProductQuestion struct {
+	ID        uint
+	ProductID uint `gorm:"index"`
+	UserID    uint
+	Content   string
 	CreatedAt time.Time
 	UpdatedAt time.Time
+
+	User    User
+	Answers []ProductAnswer `gorm:"foreignKey:QuestionID;constraint:OnDelete:CASCADE"`
+}
+
+// 商品問答的回答，管理員或已購買的會員才能回答
+type ProductAnswer struct {
+	ID              uint
+	QuestionID      uint `gorm:"index"`
+	UserID          uint
+	Content         string
+	IsAdmin         bool // 商店回答
+	IsVerifiedBuyer bool // 已購買會員回答
+	Votes           uint // 按讚數
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+
+	User      User
+	VoteUsers []AnswerVote `gorm:"foreignKey:AnswerID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+type AnswerVote struct {
+	ID        uint
+	AnswerID  uint `gorm:"uniqueIndex:idx_answer_vote_user"` // 每人只能按讚一次
+	UserID    uint `gorm:"uniqueIndex:idx_answer_vote_user"`
+	CreatedAt time.Time
+}
+
+type CommentReport struct {
+	ID        uint
+	CommentID uint `gorm:"uniqueIndex:idx_comment_report_user"` // 每人只能檢舉同一則評價一次
+	UserID    uint `gorm:"uniqueIndex:idx_comment_report_user"`
+	Reason    string
+	CreatedAt time.Time
 }
 
 type Banner struct {
@@ -106,10 +400,31 @@ type Banner struct {
 	Description string
 	ImageURL    string
 	IsActive    bool
+	SortOrder   int                 // 數字小的排前面
+	StartAt     *time.Time          // 空值表示立即開始
+	EndAt       *time.Time          // 空值表示不結束
+	LinkType    enum.BannerLinkType `gorm:"default:none"`
+	LinkTarget  string              // 商品 ID、種類 ID 或網址
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
 }
 
+// 商品共同購買統計，由排程重新計算
+type ProductRelation struct {
+	ID               uint
+	ProductID        uint `gorm:"index"`
+	RelatedProductID uint
+	Score            uint // 同時出現在幾張訂單
+	CreatedAt        time.Time
+}
+
+// Not Table
+type ProductRating struct {
+	Average      float64
+	Count        int64
+	Distribution map[uint]int64 // 星等 => 數量
+}
+
 func (u *User) HashPassword() error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
@@ -1,6 +1,8 @@
 package routes
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 	"shop.go/enum"
 	"shop.go/handler"
@@ -11,6 +13,9 @@ func Setup(router *gin.Engine) {
 	api := router.Group("/api")
 
 	Auth := middleware.Auth
+	OptionalAuth := middleware.OptionalAuth
+	Owner := middleware.Owner
+	RateLimit := middleware.RateLimit
 	RoleAdmin := enum.RoleAdmin
 	RoleUser := enum.RoleUser
 
@@ -31,27 +36,123 @@ func Setup(router *gin.Engine) {
 	api.POST("/category", Auth(RoleAdmin), handler.AddCategory)
 	api.PUT("/category/:categoryId", Auth(RoleAdmin), handler.UpdateCategory)
 	api.DELETE("/category/:categoryId", Auth(RoleAdmin), handler.DeleteCategory)
+	api.GET("/category/:categoryId/translations", Auth(RoleAdmin), handler.ListCategoryTranslations)
+	api.PUT("/category/:categoryId/translation/:locale", Auth(RoleAdmin), handler.UpdateCategoryTranslation)
+	api.DELETE("/category/:categoryId/translation/:locale", Auth(RoleAdmin), handler.DeleteCategoryTranslation)
 
 	// 商品
-	api.GET("/products", handler.ListProducts)
-	api.GET("/product/:productId", handler.GetProduct)
+	api.GET("/products", OptionalAuth(), handler.ListProducts)
+	api.GET("/products/compare", OptionalAuth(), handler.CompareProducts)
+	api.GET("/product/:productId", OptionalAuth(), handler.GetProduct)
 	api.POST("/product", Auth(RoleAdmin), handler.AddProduct)
 	api.PUT("/product/:productId", Auth(RoleAdmin), handler.UpdateProduct)
 	api.PUT("/product/:productId/image", Auth(RoleAdmin), handler.UpdateProductImage)
 	api.DELETE("/product/:productId", Auth(RoleAdmin), handler.DeleteProduct)
+	api.GET("/product/:productId/related", OptionalAuth(), handler.ListRelatedProducts)
+	api.PUT("/product/:productId/bundle", Auth(RoleAdmin), handler.SetBundleComponents)
+	api.DELETE("/product/:productId/bundle", Auth(RoleAdmin), handler.DeleteBundleComponents)
+	api.PUT("/product/:productId/digital-file", Auth(RoleAdmin), handler.UpdateProductDigitalFile)
+	api.DELETE("/product/:productId/digital-file", Auth(RoleAdmin), handler.DeleteProductDigitalFile)
+	api.POST("/product/:productId/notify-me", OptionalAuth(), handler.SubscribeStock)
+	api.PUT("/product/:productId/sale", Auth(RoleAdmin), handler.UpdateProductSale)
+	api.DELETE("/product/:productId/sale", Auth(RoleAdmin), handler.DeleteProductSale)
+	api.GET("/product/:productId/translations", Auth(RoleAdmin), handler.ListProductTranslations)
+	api.PUT("/product/:productId/translation/:locale", Auth(RoleAdmin), handler.UpdateProductTranslation)
+	api.DELETE("/product/:productId/translation/:locale", Auth(RoleAdmin), handler.DeleteProductTranslation)
+
+	// 商品發佈
+	api.GET("/product/:productId/draft", Auth(RoleAdmin), handler.GetProductDraft)
+	api.DELETE("/product/:productId/draft", Auth(RoleAdmin), handler.DeleteProductDraft)
+	api.POST("/product/:productId/publish", Auth(RoleAdmin), handler.PublishProduct)
+	api.POST("/product/:productId/unpublish", Auth(RoleAdmin), handler.UnpublishProduct)
+	api.GET("/product/:productId/revisions", Auth(RoleAdmin), handler.ListProductRevisions)
+	api.GET("/product/:productId/revision/:version/diff", Auth(RoleAdmin), handler.GetProductRevisionDiff)
+	api.POST("/product/:productId/revision/:version/rollback", Auth(RoleAdmin), handler.RollbackProductRevision)
+
+	// 庫存
+	api.GET("/products/low-stock", Auth(RoleAdmin), handler.ListLowStockProducts)
+	api.GET("/product/:productId/stock/movements", Auth(RoleAdmin), handler.ListStockMovements)
+	api.POST("/product/:productId/stock/adjustment", Auth(RoleAdmin), handler.AdjustStock)
+	api.GET("/product/:productId/stock/reconcile", Auth(RoleAdmin), handler.GetStockReconcile)
+	api.POST("/product/:productId/stock/reconcile", Auth(RoleAdmin), handler.ReconcileStock)
+	api.GET("/product/:productId/stock/warehouses", Auth(RoleAdmin), handler.ListProductWarehouseStocks)
+
+	// 倉庫
+	api.GET("/warehouses", Auth(RoleAdmin), handler.ListWarehouses)
+	api.POST("/warehouse", Auth(RoleAdmin), handler.AddWarehouse)
+	api.PUT("/warehouse/:warehouseId", Auth(RoleAdmin), handler.UpdateWarehouse)
+	api.DELETE("/warehouse/:warehouseId", Auth(RoleAdmin), handler.DeleteWarehouse)
+	api.POST("/warehouse/transfer", Auth(RoleAdmin), handler.TransferStock)
+
+	// 匯率
+	api.GET("/exchange-rates", Auth(RoleAdmin), handler.ListExchangeRates)
+	api.PUT("/exchange-rate/:currency", Auth(RoleAdmin), handler.UpdateExchangeRate)
+	api.DELETE("/exchange-rate/:currency", Auth(RoleAdmin), handler.DeleteExchangeRate)
+	api.POST("/exchange-rates/import", Auth(RoleAdmin), handler.ImportExchangeRates)
 
 	// 訂單
-	api.GET("/order/:orderId", handler.GetOrder)
+	api.GET("/order/:orderId", Auth(RoleAdmin, RoleUser), Owner("orderId", handler.OrderOwner), handler.GetOrder)
 	api.GET("/user/me/orders", Auth(RoleUser), handler.ListOrdersByCustomer)
 	api.GET("/orders", Auth(RoleAdmin), handler.ListOrdersByAdmin)
 	api.POST("/order", Auth(RoleUser), handler.CreateOrder)
 	api.PUT("/order/:orderId", Auth(RoleAdmin), handler.UpdateOrder)
+	api.GET("/order/:orderId/downloads", Auth(RoleUser), Owner("orderId", handler.OrderOwner), handler.ListOrderDownloads)
+	api.GET("/download/:token", Auth(RoleUser), handler.DownloadDigitalFile)
+
+	// 結帳
+	api.POST("/checkout/preview", Auth(RoleUser), handler.PreviewCheckout)
+
+	// 優惠券
+	api.GET("/coupons", Auth(RoleAdmin), handler.ListCoupons)
+	api.POST("/coupon", Auth(RoleAdmin), handler.AddCoupon)
+	api.DELETE("/coupon/:couponId", Auth(RoleAdmin), handler.DeleteCoupon)
 
 	// 購物車
-	api.POST("/cart/item", Auth(RoleUser), handler.AddCartItem)
-	api.PUT("/cart/item/:cartItemId", Auth(RoleUser), handler.UpdateCartItemQuantity)
-	api.DELETE("/cart/item/:cartItemId", Auth(RoleUser), handler.DeleteCartItem)
-	api.DELETE("/cart/item/all", Auth(RoleUser), handler.DeleteAllCartItem)
+	api.POST("/cart/guest", RateLimit(10, time.Hour), handler.CreateGuestCart)
+	api.GET("/cart", OptionalAuth(), handler.GetCart)
+	api.POST("/cart/item", OptionalAuth(), handler.AddCartItem)
+	api.PUT("/cart/item/:cartItemId", OptionalAuth(), Owner("cartItemId", handler.CartItemOwner), handler.UpdateCartItemQuantity)
+	api.DELETE("/cart/item/:cartItemId", OptionalAuth(), Owner("cartItemId", handler.CartItemOwner), handler.DeleteCartItem)
+	api.DELETE("/cart/item/all", OptionalAuth(), handler.DeleteAllCartItem)
+	api.POST("/cart/item/:cartItemId/save", Auth(RoleUser), Owner("cartItemId", handler.CartItemOwner), handler.SaveCartItemForLater)
+	api.POST("/cart/saved/:savedItemId/cart", Auth(RoleUser), Owner("savedItemId", handler.SavedItemOwner), handler.MoveSavedItemToCart)
+	api.DELETE("/cart/saved/:savedItemId", Auth(RoleUser), Owner("savedItemId", handler.SavedItemOwner), handler.DeleteSavedItem)
+	api.GET("/cart/recommendations", Auth(RoleUser), handler.ListCartRecommendations)
+	api.GET("/cart/reminders/stats", Auth(RoleAdmin), handler.GetCartReminderStats)
+
+	// 評價
+	api.GET("/product/:productId/comments", handler.ListProductComments)
+	api.POST("/product/:productId/comment", Auth(RoleUser), handler.AddComment)
+	api.PUT("/comment/:commentId", Auth(RoleUser), Owner("commentId", handler.CommentOwner), handler.UpdateComment)
+	api.DELETE("/comment/:commentId", Auth(RoleAdmin, RoleUser), Owner("commentId", handler.CommentOwner), handler.DeleteComment)
+	api.POST("/comment/:commentId/report", Auth(RoleUser), handler.ReportComment)
+	api.GET("/comments", Auth(RoleAdmin), handler.ListCommentsByAdmin)
+	api.PUT("/comment/:commentId/status", Auth(RoleAdmin), handler.ModerateComment)
+	api.PUT("/comment/:commentId/reply", Auth(RoleAdmin), handler.ReplyComment)
+
+	// 商品問答
+	api.GET("/product/:productId/questions", OptionalAuth(), handler.ListProductQuestions)
+	api.POST("/product/:productId/question", Auth(RoleUser), handler.AddProductQuestion)
+	api.DELETE("/question/:questionId", Auth(RoleAdmin, RoleUser), Owner("questionId", handler.QuestionOwner), handler.DeleteProductQuestion)
+	api.POST("/question/:questionId/answer", Auth(RoleAdmin, RoleUser), handler.AddProductAnswer)
+	api.DELETE("/answer/:answerId", Auth(RoleAdmin, RoleUser), Owner("answerId", handler.AnswerOwner), handler.DeleteProductAnswer)
+	api.POST("/answer/:answerId/vote", Auth(RoleUser), handler.VoteProductAnswer)
+	api.DELETE("/answer/:answerId/vote", Auth(RoleUser), handler.UnvoteProductAnswer)
+
+	// 橫幅
+	api.GET("/banners", handler.ListActiveBanners)
+	api.GET("/admin/banners", Auth(RoleAdmin), handler.ListBanners)
+	api.POST("/banner", Auth(RoleAdmin), handler.AddBanner)
+	api.PUT("/banner/:bannerId", Auth(RoleAdmin), handler.UpdateBanner)
+	api.PUT("/banner/:bannerId/image", Auth(RoleAdmin), handler.UpdateBannerImage)
+	api.DELETE("/banner/:bannerId", Auth(RoleAdmin), handler.DeleteBanner)
+
+	// 願望清單
+	api.GET("/wishlist", Auth(RoleUser), handler.ListWishlistItems)
+	api.POST("/wishlist/item", Auth(RoleUser), handler.AddWishlistItem)
+	api.DELETE("/wishlist/item/:productId", Auth(RoleUser), handler.DeleteWishlistItem)
+	api.POST("/wishlist/item/:productId/cart", Auth(RoleUser), handler.MoveWishlistItemToCart)
+	api.GET("/wishlists/report", Auth(RoleAdmin), handler.GetWishlistReport)
 
 	// 測試
 	api.GET("/hello", func(ctx *gin.Context) { ctx.JSON(200, "cool") })
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"os"
 	"time"
 
@@ -17,8 +18,49 @@ func GenerateToken(userID string, userRole string, userName string) (string, err
 	return token.SignedString([]byte(os.Getenv("TOKEN_SECRET")))
 }
 
+// 只接受登入 token，cart token 不能拿來當登入用
 func ValidateToken(tokenString string) (*jwt.Token, error) {
-	return jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
 		return []byte(os.Getenv("TOKEN_SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != nil {
+		return nil, errors.New("token is not valid")
+	}
+
+	return token, nil
+}
+
+// 訪客購物車的 token，typ 用來和登入 token 區分
+func GenerateCartToken(cartID string, ttl time.Duration) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"cart_id": cartID,
+		"typ":     "cart",
+		"exp":     time.Now().Add(ttl).Unix(),
 	})
+	return token.SignedString([]byte(os.Getenv("TOKEN_SECRET")))
+}
+
+func ValidateCartToken(tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (any, error) {
+		return []byte(os.Getenv("TOKEN_SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return "", err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != "cart" {
+		return "", errors.New("cart token is not valid")
+	}
+	cartID, ok := claims["cart_id"].(string)
+	if !ok || cartID == "" {
+		return "", errors.New("cart token is not valid")
+	}
+
+	return cartID, nil
 }